@@ -39,24 +39,20 @@ func displayStreamingMessage(msg claude.Message) {
 	case "user":
 		// User messages aren't shown as they're the input we provided
 	case "assistant":
-		// Parse assistant message content
-		var content map[string]interface{}
-		if err := json.Unmarshal(msg.Message, &content); err == nil {
-			if contentArray, ok := content["content"].([]interface{}); ok {
-				for _, item := range contentArray {
-					if itemMap, ok := item.(map[string]interface{}); ok {
-						if itemMap["type"] == "text" {
-							if text, ok := itemMap["text"].(string); ok && strings.TrimSpace(text) != "" {
-								fmt.Printf("💬 Claude: %s\n", text)
-							}
-						} else if itemMap["type"] == "tool_use" {
-							if name, ok := itemMap["name"].(string); ok {
-								if input, ok := itemMap["input"].(map[string]interface{}); ok {
-									displayToolUse(name, input)
-								}
-							}
-						}
-					}
+		// The message body is already decoded
+		if msg.Body == nil {
+			return
+		}
+		for _, block := range msg.Body.Content {
+			switch block.Type {
+			case "text":
+				if strings.TrimSpace(block.Text) != "" {
+					fmt.Printf("💬 Claude: %s\n", block.Text)
+				}
+			case "tool_use":
+				var input map[string]interface{}
+				if err := json.Unmarshal(block.Input, &input); err == nil {
+					displayToolUse(block.Name, input)
 				}
 			}
 		}
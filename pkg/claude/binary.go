@@ -0,0 +1,396 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FindOptions configures how FindBinary searches for the Claude Code CLI
+type FindOptions struct {
+	// Names are the executable names to look for (default "claude")
+	Names []string
+	// EnvVars name environment variables holding an explicit binary path
+	// They are checked first (default CLAUDE_CODE_PATH, CLAUDE_BIN)
+	EnvVars []string
+	// ExtraPaths are additional directories searched before the built-in install locations
+	ExtraPaths []string
+	// VersionConstraint restricts acceptable versions, e.g. ">=1.0.0 <2.0.0" or "^1.0.30"
+	VersionConstraint string
+	// Timeout bounds each "--version" probe (default 10 seconds)
+	Timeout time.Duration
+}
+
+// BinaryInfo describes a located Claude Code binary
+type BinaryInfo struct {
+	// Path is the absolute path to the executable
+	Path string
+	// Version is the version reported by "--version"
+	Version Version
+	// RawVersion is the unparsed "--version" output
+	RawVersion string
+	// Source describes where the binary was found (e.g. "env:CLAUDE_CODE_PATH", "PATH", "nvm")
+	Source string
+}
+
+// BinaryCandidate records a location inspected by FindBinary and why it was rejected
+type BinaryCandidate struct {
+	Path    string
+	Source  string
+	Version string
+	Reason  string
+}
+
+// BinaryNotFoundError is returned when no binary satisfying FindOptions was found
+type BinaryNotFoundError struct {
+	// Constraint is the version constraint that was requested, if any
+	Constraint string
+	// Candidates lists every existing location that was inspected
+	Candidates []BinaryCandidate
+	// Searched lists every path that was checked, including ones that did not exist
+	Searched []string
+}
+
+// Error implements the error interface
+func (e *BinaryNotFoundError) Error() string {
+	var b strings.Builder
+	b.WriteString("claude binary not found")
+	if e.Constraint != "" {
+		fmt.Fprintf(&b, " matching version %q", e.Constraint)
+	}
+	if len(e.Candidates) == 0 {
+		fmt.Fprintf(&b, " (searched %d locations)", len(e.Searched))
+		return b.String()
+	}
+	b.WriteString("; found:")
+	for _, c := range e.Candidates {
+		fmt.Fprintf(&b, "\n  %s (%s)", c.Path, c.Source)
+		if c.Version != "" {
+			fmt.Fprintf(&b, " version %s", c.Version)
+		}
+		if c.Reason != "" {
+			fmt.Fprintf(&b, ": %s", c.Reason)
+		}
+	}
+	return b.String()
+}
+
+// binaryLocation is a candidate path together with where it came from
+type binaryLocation struct {
+	path   string
+	source string
+}
+
+// FindBinary searches environment overrides, PATH and known install locations for the
+// Claude Code CLI and returns the first executable whose version satisfies the constraint
+func FindBinary(ctx context.Context, opts FindOptions) (*BinaryInfo, error) {
+	var constraint *VersionConstraint
+	if opts.VersionConstraint != "" {
+		var err error
+		constraint, err = ParseVersionConstraint(opts.VersionConstraint)
+		if err != nil {
+			return nil, NewValidationError(err.Error(), "VersionConstraint", opts.VersionConstraint)
+		}
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	notFound := &BinaryNotFoundError{Constraint: opts.VersionConstraint}
+	seen := make(map[string]bool)
+
+	for _, loc := range binaryLocations(opts) {
+		path := loc.path
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		notFound.Searched = append(notFound.Searched, path)
+
+		bin, candidate := inspectBinary(ctx, binaryLocation{path, loc.source}, constraint, opts.Timeout)
+		if bin != nil {
+			return bin, nil
+		}
+		if candidate != nil {
+			notFound.Candidates = append(notFound.Candidates, *candidate)
+		}
+	}
+
+	return nil, notFound
+}
+
+// inspectBinary checks one location, returning the binary if it is usable or
+// the reason it was rejected (nil when nothing exists at the path)
+func inspectBinary(ctx context.Context, loc binaryLocation, constraint *VersionConstraint, timeout time.Duration) (*BinaryInfo, *BinaryCandidate) {
+	info, err := os.Stat(loc.path)
+	if err != nil {
+		return nil, nil
+	}
+	if !isExecutable(info) {
+		return nil, &BinaryCandidate{Path: loc.path, Source: loc.source, Reason: "not executable"}
+	}
+
+	bin, err := probeBinary(ctx, loc.path, timeout)
+	if err != nil {
+		return nil, &BinaryCandidate{Path: loc.path, Source: loc.source, Reason: err.Error()}
+	}
+	bin.Source = loc.source
+
+	if constraint != nil && !constraint.Allows(bin.Version) {
+		return nil, &BinaryCandidate{
+			Path: loc.path, Source: loc.source, Version: bin.Version.String(),
+			Reason: "version does not satisfy constraint",
+		}
+	}
+
+	return bin, nil
+}
+
+// binaryLocations lists candidate paths in search order
+func binaryLocations(opts FindOptions) []binaryLocation {
+	names := opts.Names
+	if len(names) == 0 {
+		names = []string{"claude"}
+	}
+	envVars := opts.EnvVars
+	if len(envVars) == 0 {
+		envVars = []string{"CLAUDE_CODE_PATH", "CLAUDE_BIN"}
+	}
+
+	var locations []binaryLocation
+
+	for _, name := range envVars {
+		if value := os.Getenv(name); value != "" {
+			locations = append(locations, binaryLocation{value, "env:" + name})
+		}
+	}
+
+	// Names given as paths are checked directly
+	for _, name := range names {
+		if isPathName(name) {
+			locations = append(locations, binaryLocation{name, "explicit"})
+		}
+	}
+
+	addDir := func(dir, source string) {
+		if dir == "" {
+			return
+		}
+		for _, name := range names {
+			for _, file := range executableNames(filepath.Base(name)) {
+				locations = append(locations, binaryLocation{filepath.Join(dir, file), source})
+			}
+		}
+	}
+
+	for _, dir := range opts.ExtraPaths {
+		addDir(dir, "extra")
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		addDir(dir, "PATH")
+	}
+
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		// Local installs created by "claude migrate-installer"
+		addDir(filepath.Join(home, ".claude", "local"), "claude-local")
+	}
+
+	// npm global installs
+	for _, prefix := range []string{os.Getenv("NPM_CONFIG_PREFIX"), os.Getenv("npm_config_prefix")} {
+		if prefix != "" {
+			addDir(filepath.Join(prefix, "bin"), "npm-global")
+			addDir(prefix, "npm-global")
+		}
+	}
+	if home != "" {
+		addDir(filepath.Join(home, ".npm-global", "bin"), "npm-global")
+		addDir(filepath.Join(home, ".local", "bin"), "user-local")
+		addDir(filepath.Join(home, ".volta", "bin"), "volta")
+	}
+	addDir("/usr/local/bin", "system")
+	addDir("/opt/homebrew/bin", "homebrew")
+	if runtime.GOOS == "windows" {
+		addDir(filepath.Join(os.Getenv("APPDATA"), "npm"), "npm-global")
+	}
+
+	// nvm installs, newest Node version first
+	nvmDir := os.Getenv("NVM_DIR")
+	if nvmDir == "" && home != "" {
+		nvmDir = filepath.Join(home, ".nvm")
+	}
+	if nvmDir != "" {
+		nodeDirs, _ := filepath.Glob(filepath.Join(nvmDir, "versions", "node", "*"))
+		sort.Slice(nodeDirs, func(i, j int) bool {
+			vi, _ := ParseVersion(filepath.Base(nodeDirs[i]))
+			vj, _ := ParseVersion(filepath.Base(nodeDirs[j]))
+			return vi.Compare(vj) > 0
+		})
+		for _, dir := range nodeDirs {
+			addDir(filepath.Join(dir, "bin"), "nvm")
+		}
+	}
+
+	return locations
+}
+
+// executableNames returns the file names an executable may have on this platform
+func executableNames(name string) []string {
+	if runtime.GOOS == "windows" && filepath.Ext(name) == "" {
+		return []string{name + ".exe", name + ".cmd", name}
+	}
+	return []string{name}
+}
+
+// isExecutable reports whether the file can be executed by the current user
+func isExecutable(info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+// probeBinary runs "<path> --version" and parses the reported version
+func probeBinary(ctx context.Context, path string, timeout time.Duration) (*BinaryInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := execCommand(ctx, path, "--version")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("version check timed out after %s", timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("version check failed: %s", msg)
+	}
+
+	raw := strings.TrimSpace(stdout.String())
+	version, err := ParseVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BinaryInfo{
+		Path:       path,
+		Version:    version,
+		RawVersion: raw,
+	}, nil
+}
+
+// WithVersionConstraint pins the client to CLI versions matching constraint
+// The binary is verified on first use; when BinPath is a bare name, known install
+// locations are searched for a matching version
+func WithVersionConstraint(constraint string) ClientOption {
+	return func(c *ClaudeClient) {
+		c.VersionConstraint = constraint
+	}
+}
+
+// BinaryInfo resolves the client's binary and reports its path and version
+// The result is cached after the first successful lookup
+func (c *ClaudeClient) BinaryInfo(ctx context.Context) (*BinaryInfo, error) {
+	c.binaryMu.Lock()
+	defer c.binaryMu.Unlock()
+
+	if c.binary != nil {
+		return c.binary, nil
+	}
+
+	binPath := c.BinPath
+	if binPath == "" {
+		binPath = "claude"
+	}
+
+	var info *BinaryInfo
+	var err error
+	switch {
+	case isPathName(binPath):
+		// An explicit path is the only acceptable binary
+		info, err = findExplicitBinary(ctx, binPath, c.VersionConstraint)
+	case c.VersionConstraint == "":
+		// Without a pin, report the binary exec would run from PATH
+		path, lookErr := exec.LookPath(binPath)
+		if lookErr != nil {
+			return nil, &BinaryNotFoundError{Searched: filepath.SplitList(os.Getenv("PATH"))}
+		}
+		info, err = findExplicitBinary(ctx, path, "")
+		if info != nil {
+			info.Source = "PATH"
+		}
+	default:
+		info, err = FindBinary(ctx, FindOptions{Names: []string{binPath}, VersionConstraint: c.VersionConstraint})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.binary = info
+	return info, nil
+}
+
+// findExplicitBinary checks a single binary path against the version constraint
+func findExplicitBinary(ctx context.Context, path string, versionConstraint string) (*BinaryInfo, error) {
+	var constraint *VersionConstraint
+	if versionConstraint != "" {
+		var err error
+		constraint, err = ParseVersionConstraint(versionConstraint)
+		if err != nil {
+			return nil, NewValidationError(err.Error(), "VersionConstraint", versionConstraint)
+		}
+	}
+
+	bin, candidate := inspectBinary(ctx, binaryLocation{path, "explicit"}, constraint, 10*time.Second)
+	if bin != nil {
+		return bin, nil
+	}
+
+	notFound := &BinaryNotFoundError{Constraint: versionConstraint, Searched: []string{path}}
+	if candidate != nil {
+		notFound.Candidates = append(notFound.Candidates, *candidate)
+	}
+	return nil, notFound
+}
+
+// isPathName returns true if name refers to a file path rather than a command name
+func isPathName(name string) bool {
+	return strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/")
+}
+
+// ResolveBinPath returns the binary to execute, enforcing the version pin if one is set
+// A missing binary is reported as an ErrorCLINotFound ClaudeError wrapping the BinaryNotFoundError
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) ResolveBinPath(ctx context.Context) (string, error) {
+	if c.VersionConstraint == "" {
+		return c.BinPath, nil
+	}
+	info, err := c.BinaryInfo(ctx)
+	if err != nil {
+		if isNotFoundError(err) {
+			return "", NewCLINotFoundError(err)
+		}
+		return "", err
+	}
+	return info.Path, nil
+}
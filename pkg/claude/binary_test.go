@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFakeBinary creates an executable script that prints the given version
+func writeFakeBinary(t *testing.T, dir, name, version string, mode os.FileMode) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\necho '" + version + " (Claude Code)'\n"
+	if err := os.WriteFile(path, []byte(script), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// isolateBinarySearch points every search location at an empty temp directory
+func isolateBinarySearch(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries are shell scripts")
+	}
+	root := t.TempDir()
+	t.Setenv("PATH", filepath.Join(root, "path"))
+	t.Setenv("HOME", filepath.Join(root, "home"))
+	t.Setenv("NVM_DIR", filepath.Join(root, "nvm"))
+	t.Setenv("NPM_CONFIG_PREFIX", "")
+	t.Setenv("npm_config_prefix", "")
+	t.Setenv("CLAUDE_CODE_PATH", "")
+	t.Setenv("CLAUDE_BIN", "")
+	return root
+}
+
+func TestFindBinary(t *testing.T) {
+	const name = "claude-sdk-test"
+	root := isolateBinarySearch(t)
+
+	writeFakeBinary(t, filepath.Join(root, "path"), name, "0.9.0", 0755)
+	writeFakeBinary(t, filepath.Join(root, "home", ".claude", "local"), name, "1.0.40", 0755)
+	writeFakeBinary(t, filepath.Join(root, "nvm", "versions", "node", "v18.0.0", "bin"), name, "1.0.10", 0755)
+	writeFakeBinary(t, filepath.Join(root, "nvm", "versions", "node", "v20.1.0", "bin"), name, "1.0.20", 0644)
+
+	ctx := context.Background()
+
+	// Without a constraint the first executable on PATH wins
+	info, err := FindBinary(ctx, FindOptions{Names: []string{name}})
+	if err != nil {
+		t.Fatalf("FindBinary failed: %v", err)
+	}
+	if info.Source != "PATH" || info.Version != (Version{0, 9, 0}) {
+		t.Errorf("Expected PATH binary 0.9.0, got %s %s", info.Source, info.Version)
+	}
+
+	// A constraint skips non-matching binaries
+	info, err = FindBinary(ctx, FindOptions{Names: []string{name}, VersionConstraint: ">=1.0.0"})
+	if err != nil {
+		t.Fatalf("FindBinary failed: %v", err)
+	}
+	if info.Source != "claude-local" || info.Version != (Version{1, 0, 40}) {
+		t.Errorf("Expected claude-local binary 1.0.40, got %s %s", info.Source, info.Version)
+	}
+
+	// Env overrides take precedence over every other location
+	override := writeFakeBinary(t, filepath.Join(root, "override"), name, "1.0.5", 0755)
+	t.Setenv("CLAUDE_CODE_PATH", override)
+	info, err = FindBinary(ctx, FindOptions{Names: []string{name}, VersionConstraint: "^1.0.0"})
+	if err != nil {
+		t.Fatalf("FindBinary failed: %v", err)
+	}
+	if info.Path != override || info.Source != "env:CLAUDE_CODE_PATH" {
+		t.Errorf("Expected env override, got %s from %s", info.Path, info.Source)
+	}
+
+	// Nothing matches: the error lists what was found where
+	_, err = FindBinary(ctx, FindOptions{Names: []string{name}, VersionConstraint: ">=2.0.0"})
+	var notFound *BinaryNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected BinaryNotFoundError, got %v", err)
+	}
+	if len(notFound.Candidates) != 5 {
+		t.Errorf("Expected 5 candidates, got %d: %+v", len(notFound.Candidates), notFound.Candidates)
+	}
+	message := err.Error()
+	for _, expected := range []string{">=2.0.0", "version 1.0.40", "(nvm)", "not executable", "env:CLAUDE_CODE_PATH"} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected error to mention %q, got:\n%s", expected, message)
+		}
+	}
+}
+
+func TestFindBinary_InvalidConstraint(t *testing.T) {
+	_, err := FindBinary(context.Background(), FindOptions{VersionConstraint: "latest"})
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorValidation {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+}
+
+func TestClaudeClient_VersionConstraint(t *testing.T) {
+	const name = "claude-sdk-test"
+	root := isolateBinarySearch(t)
+
+	writeFakeBinary(t, filepath.Join(root, "path"), name, "0.9.0", 0755)
+	pinned := writeFakeBinary(t, filepath.Join(root, "home", ".npm-global", "bin"), name, "1.2.0", 0755)
+
+	client := NewClient(name, WithVersionConstraint(">=1.0.0"))
+	path, err := client.ResolveBinPath(context.Background())
+	if err != nil {
+		t.Fatalf("ResolveBinPath failed: %v", err)
+	}
+	if path != pinned {
+		t.Errorf("Expected pinned binary %s, got %s", pinned, path)
+	}
+
+	// An explicit path is never replaced by another binary
+	explicit := NewClient(filepath.Join(root, "path", name), WithVersionConstraint(">=1.0.0"))
+	if _, err := explicit.RunPrompt("test", &RunOptions{}); err == nil {
+		t.Fatal("Expected version mismatch error")
+	} else if !strings.Contains(err.Error(), "version 0.9.0") {
+		t.Errorf("Expected error to report found version, got %v", err)
+	}
+
+	// Without a pin the binary on PATH is reported
+	info, err := NewClient(name).BinaryInfo(context.Background())
+	if err != nil {
+		t.Fatalf("BinaryInfo failed: %v", err)
+	}
+	if info.Version != (Version{0, 9, 0}) || info.Source != "PATH" {
+		t.Errorf("Expected PATH binary 0.9.0, got %s from %s", info.Version, info.Source)
+	}
+}
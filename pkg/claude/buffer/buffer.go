@@ -21,6 +21,21 @@ type Config struct {
 	EnableTruncation bool
 	// TruncationSuffix is added when content is truncated
 	TruncationSuffix string
+	// StdoutMode and StderrMode select how output beyond the size limits is handled
+	// When empty, stdout uses ModeTruncate and stderr uses ModeRing
+	StdoutMode Mode
+	StderrMode Mode
+	// RingHeadSize is how many leading bytes ModeRing keeps in addition to the tail
+	RingHeadSize int64
+	// SpillDir is where ModeSpill creates temporary files (default os.TempDir)
+	SpillDir string
+	// MaxSpillSize caps the total size of a spilled buffer in bytes; 0 means no cap
+	MaxSpillSize int64
+	// Recovery makes ModeTruncate streams use a ResilientBuffer with this configuration
+	Recovery *RecoveryConfig
+	// MaxLineSize is the longest stream-json line decoded; longer lines are discarded
+	// Zero uses the decoder's default of 10MB
+	MaxLineSize int64
 }
 
 // DefaultConfig returns sensible default buffer configuration
@@ -31,6 +46,10 @@ func DefaultConfig() *Config {
 		BufferTimeout:     30 * time.Second,
 		EnableTruncation:  true,
 		TruncationSuffix:  "\n[... output truncated due to size limit ...]",
+		StdoutMode:        ModeTruncate,
+		StderrMode:        ModeRing,
+		RingHeadSize:      4 * 1024, // 4KB
+		MaxLineSize:       10 * 1024 * 1024, // 10MB
 	}
 }
 
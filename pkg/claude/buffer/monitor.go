@@ -0,0 +1,221 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// monitorBuckets is the number of buckets a Monitor splits its window into
+const monitorBuckets = 60
+
+// DefaultMonitorWindow is the rolling window used when NewMonitor is given zero
+const DefaultMonitorWindow = 5 * time.Minute
+
+// Monitor aggregates buffer metrics across runs, both over the lifetime and a rolling window
+// Health is computed from the window so old problems stop counting once they age out
+type Monitor struct {
+	mu       sync.Mutex
+	window   time.Duration
+	width    time.Duration
+	buckets  [monitorBuckets]monitorBucket
+	lifetime *Metrics
+	health   *HealthChecker
+	now      func() time.Time
+}
+
+// monitorBucket holds the counters for one slice of the window
+type monitorBucket struct {
+	slot        int64 // time slot the counters belong to
+	bytes       int64
+	writes      int64
+	truncations int64
+	timeouts    int64
+	errors      int64
+	maxWrite    int64
+	last        time.Time
+}
+
+// NewMonitor creates a monitor with the given rolling window (DefaultMonitorWindow when zero)
+func NewMonitor(window time.Duration) *Monitor {
+	if window <= 0 {
+		window = DefaultMonitorWindow
+	}
+	width := window / monitorBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &Monitor{
+		window:   window,
+		width:    width,
+		lifetime: NewMetrics(),
+		health:   NewHealthChecker(),
+		now:      time.Now,
+	}
+}
+
+// bucket returns the bucket for the current time, clearing it if it holds an old slot
+// The caller holds the lock
+func (m *Monitor) bucket() *monitorBucket {
+	now := m.now()
+	slot := now.UnixNano() / int64(m.width)
+	b := &m.buckets[slot%monitorBuckets]
+	if b.slot != slot {
+		*b = monitorBucket{slot: slot}
+	}
+	b.last = now
+	return b
+}
+
+// recordWrite records a write of n bytes and whether it caused truncation
+func (m *Monitor) recordWrite(n int64, truncated bool) {
+	m.lifetime.RecordWrite(n)
+	if truncated {
+		m.lifetime.RecordTruncation()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket()
+	b.bytes += n
+	b.writes++
+	if truncated {
+		b.truncations++
+	}
+	if n > b.maxWrite {
+		b.maxWrite = n
+	}
+}
+
+// RecordTimeout records a buffer copy timeout
+func (m *Monitor) RecordTimeout() {
+	m.lifetime.RecordTimeout()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bucket().timeouts++
+}
+
+// RecordError records a buffer error
+func (m *Monitor) RecordError() {
+	m.lifetime.RecordError()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bucket().errors++
+}
+
+// Stats returns statistics for the rolling window
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.now().UnixNano() / int64(m.width)
+	var stats Stats
+	for _, b := range m.buckets {
+		if b.writes == 0 && b.timeouts == 0 && b.errors == 0 {
+			continue
+		}
+		if current-b.slot >= monitorBuckets {
+			continue // Outside the window
+		}
+		stats.TotalBytesWritten += b.bytes
+		stats.OperationCount += b.writes
+		stats.TotalTruncations += b.truncations
+		stats.TotalTimeouts += b.timeouts
+		stats.ErrorCount += b.errors
+		if b.maxWrite > stats.MaxBufferSizeSeen {
+			stats.MaxBufferSizeSeen = b.maxWrite
+		}
+		if b.last.After(stats.LastOperationTime) {
+			stats.LastOperationTime = b.last
+		}
+	}
+	if stats.OperationCount > 0 {
+		stats.AverageWriteSize = float64(stats.TotalBytesWritten) / float64(stats.OperationCount)
+	}
+	return stats
+}
+
+// LifetimeStats returns statistics since the monitor was created
+func (m *Monitor) LifetimeStats() Stats {
+	return m.lifetime.GetStats()
+}
+
+// Health checks the health of the buffer system over the rolling window
+func (m *Monitor) Health() HealthStatus {
+	return m.health.CheckHealth(m.Stats())
+}
+
+// Window returns the monitor's rolling window
+func (m *Monitor) Window() time.Duration {
+	return m.window
+}
+
+// MonitoredOutput wraps an Output with per-buffer metrics, also reporting to an optional Monitor
+type MonitoredOutput struct {
+	Output
+	metrics *Metrics
+	monitor *Monitor
+}
+
+// NewMonitoredOutput wraps out; monitor may be nil
+func NewMonitoredOutput(out Output, monitor *Monitor) *MonitoredOutput {
+	return &MonitoredOutput{Output: out, metrics: NewMetrics(), monitor: monitor}
+}
+
+// Write implements io.Writer with metrics tracking
+func (mo *MonitoredOutput) Write(p []byte) (int, error) {
+	wasTruncated := mo.Output.Truncated()
+	n, err := mo.Output.Write(p)
+	truncated := !wasTruncated && mo.Output.Truncated()
+
+	mo.metrics.RecordWrite(int64(len(p)))
+	if truncated {
+		mo.metrics.RecordTruncation()
+	}
+	if err != nil {
+		mo.metrics.RecordError()
+	}
+
+	if mo.monitor != nil {
+		mo.monitor.recordWrite(int64(len(p)), truncated)
+		if err != nil {
+			mo.monitor.RecordError()
+		}
+	}
+	return n, err
+}
+
+// GetMetrics returns the buffer's metrics
+func (mo *MonitoredOutput) GetMetrics() Stats {
+	return mo.metrics.GetStats()
+}
+
+// FallbackUsed reports whether a wrapped ResilientBuffer switched to its fallback buffer
+func (mo *MonitoredOutput) FallbackUsed() bool {
+	if rb, ok := mo.Output.(*ResilientBuffer); ok {
+		return rb.IsUsingFallback()
+	}
+	return false
+}
+
+// Size returns the current size of the active buffer
+func (rb *ResilientBuffer) Size() int64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	if rb.usingFallback {
+		return rb.fallbackBuffer.Size()
+	}
+	return rb.primaryBuffer.Size()
+}
+
+// Reader returns a reader over the buffer contents
+func (rb *ResilientBuffer) Reader() (io.ReadSeekCloser, error) {
+	return nopCloser{bytes.NewReader(rb.Bytes())}, nil
+}
+
+// Close is a no-op; it lets ResilientBuffer be used as an Output
+func (rb *ResilientBuffer) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonitor_RollingWindow(t *testing.T) {
+	m := NewMonitor(time.Minute)
+	now := time.Unix(1000, 0)
+	m.now = func() time.Time { return now }
+
+	out := NewMonitoredOutput(NewLimitedBuffer(4, ""), m)
+	out.Write([]byte("abc"))
+	out.Write([]byte("defg"))
+	m.RecordError()
+	m.RecordTimeout()
+
+	stats := m.Stats()
+	if stats.TotalBytesWritten != 7 || stats.OperationCount != 2 || stats.TotalTruncations != 1 || stats.ErrorCount != 1 || stats.TotalTimeouts != 1 {
+		t.Errorf("Unexpected window stats: %+v", stats)
+	}
+	if m.Health().IsHealthy {
+		t.Error("Expected errors within the window to be unhealthy")
+	}
+
+	// Once the events age out of the window the monitor recovers; lifetime stats keep them
+	now = now.Add(2 * time.Minute)
+	if stats := m.Stats(); stats.OperationCount != 0 || stats.ErrorCount != 0 {
+		t.Errorf("Expected empty window, got %+v", stats)
+	}
+	health := m.Health()
+	if !health.IsHealthy || len(health.Issues) != 0 {
+		t.Errorf("Expected healthy status after the window, got %+v", health)
+	}
+	if lifetime := m.LifetimeStats(); lifetime.OperationCount != 2 || lifetime.ErrorCount != 1 {
+		t.Errorf("Unexpected lifetime stats: %+v", lifetime)
+	}
+
+	// Per-buffer metrics are independent of the monitor
+	if got := out.GetMetrics(); got.OperationCount != 2 || got.TotalTruncations != 1 {
+		t.Errorf("Unexpected buffer metrics: %+v", got)
+	}
+}
+
+func TestMonitoredOutput_Fallback(t *testing.T) {
+	config := DefaultConfig()
+	config.StdoutMode = ModeTruncate
+	config.Recovery = DefaultRecoveryConfig()
+	bm := NewBufferManager(config)
+
+	out := NewMonitoredOutput(bm.NewStdoutOutput(), nil)
+	if _, ok := out.Output.(*ResilientBuffer); !ok {
+		t.Fatalf("Expected a ResilientBuffer with Recovery set, got %T", out.Output)
+	}
+	out.Write([]byte("hello"))
+	if out.FallbackUsed() || out.String() != "hello" || out.Size() != 5 {
+		t.Errorf("Unexpected resilient output state: %q fallback %v", out.String(), out.FallbackUsed())
+	}
+}
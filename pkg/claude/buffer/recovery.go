@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -269,6 +270,9 @@ func (rc *ResilientCopy) GetMetrics() Stats {
 	return rc.metrics.GetStats()
 }
 
+// ErrCircuitOpen is returned while the circuit breaker rejects operations
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
 // CircuitBreaker prevents cascade failures in buffer operations
 type CircuitBreaker struct {
 	mu                sync.RWMutex
@@ -277,6 +281,9 @@ type CircuitBreaker struct {
 	consecutiveFailures int
 	lastFailureTime   time.Time
 	state             CircuitState
+	probeInFlight     bool
+	onStateChange     func(from, to CircuitState)
+	metrics           CircuitBreakerMetrics
 }
 
 // CircuitState represents the state of a circuit breaker
@@ -291,6 +298,31 @@ const (
 	StateHalfOpen
 )
 
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerMetrics tracks circuit breaker activity
+type CircuitBreakerMetrics struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	Successes           int64
+	Failures            int64
+	Rejected            int64
+	Trips               int64
+	LastStateChange     time.Time
+}
+
 // NewCircuitBreaker creates a new circuit breaker
 func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *CircuitBreaker {
 	return &CircuitBreaker{
@@ -300,10 +332,18 @@ func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *Circui
 	}
 }
 
+// OnStateChange registers a callback invoked after every state transition
+// The callback runs without the breaker's lock held
+func (cb *CircuitBreaker) OnStateChange(fn func(from, to CircuitState)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.onStateChange = fn
+}
+
 // Execute runs an operation through the circuit breaker
 func (cb *CircuitBreaker) Execute(operation func() error) error {
-	if !cb.canExecute() {
-		return fmt.Errorf("circuit breaker is open")
+	if err := cb.Allow(); err != nil {
+		return err
 	}
 	
 	err := operation()
@@ -311,42 +351,122 @@ func (cb *CircuitBreaker) Execute(operation func() error) error {
 	return err
 }
 
+// Allow reports whether an operation may proceed, returning ErrCircuitOpen if not
+// In the half-open state only a single probe is allowed until its result is recorded
+// Every allowed operation must be followed by RecordSuccess, RecordFailure or RecordIgnored
+func (cb *CircuitBreaker) Allow() error {
+	if !cb.canExecute() {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// RecordSuccess records a successful operation
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.recordResult(nil)
+}
+
+// RecordFailure records a failed operation
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.recordResult(ErrCircuitOpen)
+}
+
+// RecordIgnored records an operation whose outcome says nothing about the protected service,
+// e.g. one canceled by the caller; a half-open probe is released without changing state
+func (cb *CircuitBreaker) RecordIgnored() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probeInFlight = false
+}
+
+// RetryAfter returns how long the breaker stays open before allowing a probe
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	
+	if cb.state != StateOpen {
+		return 0
+	}
+	remaining := cb.resetTimeout - time.Since(cb.lastFailureTime)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 // canExecute determines if an operation can be executed
 func (cb *CircuitBreaker) canExecute() bool {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
 	
+	var allowed bool
+	from := cb.state
 	switch cb.state {
 	case StateClosed:
-		return true
+		allowed = true
 	case StateOpen:
 		if time.Since(cb.lastFailureTime) > cb.resetTimeout {
-			cb.state = StateHalfOpen
-			return true
+			cb.setState(StateHalfOpen)
+			cb.probeInFlight = true
+			allowed = true
 		}
-		return false
 	case StateHalfOpen:
-		return true
-	default:
-		return false
+		if !cb.probeInFlight {
+			cb.probeInFlight = true
+			allowed = true
+		}
+	}
+	if !allowed {
+		cb.metrics.Rejected++
 	}
+	
+	cb.unlockAndNotify(from)
+	return allowed
 }
 
 // recordResult records the result of an operation
 func (cb *CircuitBreaker) recordResult(err error) {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
 	
+	from := cb.state
+	cb.probeInFlight = false
 	if err != nil {
+		cb.metrics.Failures++
 		cb.consecutiveFailures++
 		cb.lastFailureTime = time.Now()
 		
-		if cb.consecutiveFailures >= cb.failureThreshold {
-			cb.state = StateOpen
+		// A failed probe reopens the circuit immediately
+		if cb.state == StateHalfOpen || cb.consecutiveFailures >= cb.failureThreshold {
+			cb.setState(StateOpen)
 		}
 	} else {
+		cb.metrics.Successes++
 		cb.consecutiveFailures = 0
-		cb.state = StateClosed
+		cb.setState(StateClosed)
+	}
+	
+	cb.unlockAndNotify(from)
+}
+
+// setState changes the state and updates metrics; the caller must hold the lock
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+	if state == StateOpen {
+		cb.metrics.Trips++
+	}
+	cb.state = state
+	cb.metrics.LastStateChange = time.Now()
+}
+
+// unlockAndNotify releases the lock and runs the state change callback if the state moved from from
+func (cb *CircuitBreaker) unlockAndNotify(from CircuitState) {
+	to := cb.state
+	callback := cb.onStateChange
+	cb.mu.Unlock()
+	
+	if callback != nil && from != to {
+		callback(from, to)
 	}
 }
 
@@ -355,4 +475,15 @@ func (cb *CircuitBreaker) GetState() CircuitState {
 	cb.mu.RLock()
 	defer cb.mu.RUnlock()
 	return cb.state
-}
\ No newline at end of file
+}
+
+// Metrics returns a snapshot of the circuit breaker metrics
+func (cb *CircuitBreaker) Metrics() CircuitBreakerMetrics {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	
+	metrics := cb.metrics
+	metrics.State = cb.state
+	metrics.ConsecutiveFailures = cb.consecutiveFailures
+	return metrics
+}
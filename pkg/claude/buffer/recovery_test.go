@@ -0,0 +1,95 @@
+package buffer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	cb := NewCircuitBreaker(2, 20*time.Millisecond)
+
+	var transitions []string
+	cb.OnStateChange(func(from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	})
+
+	failing := errors.New("boom")
+	cb.Execute(func() error { return failing })
+	if cb.GetState() != StateClosed {
+		t.Fatalf("Expected closed after one failure, got %v", cb.GetState())
+	}
+	cb.Execute(func() error { return failing })
+	if cb.GetState() != StateOpen {
+		t.Fatalf("Expected open after threshold, got %v", cb.GetState())
+	}
+
+	if err := cb.Execute(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen while open, got %v", err)
+	}
+	if cb.RetryAfter() <= 0 {
+		t.Error("Expected a positive RetryAfter while open")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	// Only one probe is allowed while half-open
+	if err := cb.Allow(); err != nil {
+		t.Fatalf("Expected probe to be allowed, got %v", err)
+	}
+	if cb.GetState() != StateHalfOpen {
+		t.Errorf("Expected half-open, got %v", cb.GetState())
+	}
+	if err := cb.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected second probe to be rejected, got %v", err)
+	}
+
+	// A failed probe reopens the circuit
+	cb.RecordFailure()
+	if cb.GetState() != StateOpen {
+		t.Errorf("Expected failed probe to reopen, got %v", cb.GetState())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	cb.Allow()
+	cb.RecordSuccess()
+	if cb.GetState() != StateClosed {
+		t.Errorf("Expected successful probe to close, got %v", cb.GetState())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, transitions)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Errorf("Transition %d = %q, want %q", i, transitions[i], want[i])
+		}
+	}
+}
+
+func TestCircuitBreaker_Metrics(t *testing.T) {
+	cb := NewCircuitBreaker(1, time.Hour)
+
+	cb.Execute(func() error { return nil })
+	cb.Execute(func() error { return errors.New("boom") })
+	cb.Execute(func() error { return nil })
+
+	m := cb.Metrics()
+	if m.Successes != 1 || m.Failures != 1 || m.Rejected != 1 || m.Trips != 1 {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+	if m.State != StateOpen || m.ConsecutiveFailures != 1 || m.LastStateChange.IsZero() {
+		t.Errorf("Unexpected state in metrics: %+v", m)
+	}
+
+	// Ignored outcomes release a probe without changing state
+	probe := NewCircuitBreaker(1, 0)
+	probe.RecordFailure()
+	time.Sleep(time.Millisecond)
+	probe.Allow()
+	probe.RecordIgnored()
+	if err := probe.Allow(); err != nil {
+		t.Errorf("Expected probe to be available again, got %v", err)
+	}
+}
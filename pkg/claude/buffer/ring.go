@@ -0,0 +1,140 @@
+package buffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ModeRing keeps the last bytes up to the limit, plus optionally the first RingHeadSize bytes
+const ModeRing Mode = "ring"
+
+// ElisionMarkerFormat is inserted between the head and tail of a RingBuffer that dropped bytes
+const ElisionMarkerFormat = "\n[... %d bytes elided ...]\n"
+
+// RingBuffer retains the first headSize bytes and the last tailSize bytes written to it
+// It suits stderr, where the final lines usually carry the error
+type RingBuffer struct {
+	mu       sync.RWMutex
+	head     []byte
+	headSize int64
+	tail     []byte // circular, len(tail) == tailSize once full
+	tailSize int64
+	start    int // index of the oldest tail byte
+	written  int64
+}
+
+// NewRingBuffer creates a ring buffer keeping the last tailSize bytes and the first headSize bytes
+func NewRingBuffer(tailSize, headSize int64) *RingBuffer {
+	return &RingBuffer{
+		tailSize: max(tailSize, 0),
+		headSize: max(headSize, 0),
+	}
+}
+
+// Write implements io.Writer; it never fails
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	originalLen := len(p)
+	rb.written += int64(originalLen)
+
+	if room := rb.headSize - int64(len(rb.head)); room > 0 {
+		n := min(room, int64(len(p)))
+		rb.head = append(rb.head, p[:n]...)
+		p = p[n:]
+	}
+	if rb.tailSize == 0 || len(p) == 0 {
+		return originalLen, nil
+	}
+
+	// Only the last tailSize bytes of a large write can survive
+	if int64(len(p)) >= rb.tailSize {
+		rb.tail = append(rb.tail[:0], p[int64(len(p))-rb.tailSize:]...)
+		rb.start = 0
+		return originalLen, nil
+	}
+
+	for len(p) > 0 {
+		if int64(len(rb.tail)) < rb.tailSize {
+			n := min(rb.tailSize-int64(len(rb.tail)), int64(len(p)))
+			rb.tail = append(rb.tail, p[:n]...)
+			p = p[n:]
+			continue
+		}
+		n := copy(rb.tail[rb.start:], p)
+		rb.start = (rb.start + n) % len(rb.tail)
+		p = p[n:]
+	}
+
+	return originalLen, nil
+}
+
+// elided returns the number of dropped bytes; the caller holds the lock
+func (rb *RingBuffer) elided() int64 {
+	return rb.written - int64(len(rb.head)) - int64(len(rb.tail))
+}
+
+// Bytes returns the head, an elision marker if bytes were dropped, and the tail
+func (rb *RingBuffer) Bytes() []byte {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	var buf bytes.Buffer
+	buf.Grow(len(rb.head) + len(rb.tail) + len(ElisionMarkerFormat) + 20)
+	buf.Write(rb.head)
+	if dropped := rb.elided(); dropped > 0 {
+		fmt.Fprintf(&buf, ElisionMarkerFormat, dropped)
+	}
+	buf.Write(rb.tail[rb.start:])
+	buf.Write(rb.tail[:rb.start])
+	return buf.Bytes()
+}
+
+// String returns the retained content as a string
+func (rb *RingBuffer) String() string {
+	return string(rb.Bytes())
+}
+
+// Size returns the number of bytes retained
+func (rb *RingBuffer) Size() int64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return int64(len(rb.head) + len(rb.tail))
+}
+
+// Written returns the total number of bytes written, including dropped ones
+func (rb *RingBuffer) Written() int64 {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.written
+}
+
+// Truncated returns whether bytes between the head and tail were dropped
+func (rb *RingBuffer) Truncated() bool {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.elided() > 0
+}
+
+// Reader returns a reader over the retained content
+func (rb *RingBuffer) Reader() (io.ReadSeekCloser, error) {
+	return nopCloser{bytes.NewReader(rb.Bytes())}, nil
+}
+
+// Close is a no-op; it lets RingBuffer be used as an Output
+func (rb *RingBuffer) Close() error {
+	return nil
+}
+
+// Reset clears the buffer
+func (rb *RingBuffer) Reset() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.head = rb.head[:0]
+	rb.tail = rb.tail[:0]
+	rb.start = 0
+	rb.written = 0
+}
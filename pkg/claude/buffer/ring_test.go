@@ -0,0 +1,63 @@
+package buffer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	tests := []struct {
+		name      string
+		tail      int64
+		head      int64
+		writes    []string
+		want      string
+		wantTrunc bool
+	}{
+		{"fits", 10, 0, []string{"abc", "def"}, "abcdef", false},
+		{"keeps tail", 4, 0, []string{"abc", "def", "gh"}, fmt.Sprintf(ElisionMarkerFormat, 4) + "efgh", true},
+		{"large write", 3, 0, []string{"a", "0123456789"}, fmt.Sprintf(ElisionMarkerFormat, 8) + "789", true},
+		{"head and tail", 3, 2, []string{"Error: start", "...", "final"}, "Er" + fmt.Sprintf(ElisionMarkerFormat, 15) + "nal", true},
+		{"head only fills", 3, 4, []string{"ab", "cdef"}, "abcdef", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rb := NewRingBuffer(tt.tail, tt.head)
+			written := 0
+			for _, w := range tt.writes {
+				if n, err := rb.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+				written += len(w)
+			}
+			if got := rb.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if rb.Truncated() != tt.wantTrunc || rb.Written() != int64(written) {
+				t.Errorf("Truncated() = %v, Written() = %d", rb.Truncated(), rb.Written())
+			}
+		})
+	}
+}
+
+func TestRingBuffer_ManySmallWrites(t *testing.T) {
+	rb := NewRingBuffer(16, 0)
+	var all strings.Builder
+	for i := 0; i < 100; i++ {
+		line := fmt.Sprintf("%d,", i)
+		rb.Write([]byte(line))
+		all.WriteString(line)
+	}
+	content := all.String()
+	want := content[len(content)-16:]
+	if got := rb.String(); !strings.HasSuffix(got, want) || rb.Size() != 16 {
+		t.Errorf("Expected last 16 bytes %q, got %q", want, got)
+	}
+
+	rb.Reset()
+	if rb.String() != "" || rb.Truncated() {
+		t.Error("Expected empty buffer after Reset")
+	}
+}
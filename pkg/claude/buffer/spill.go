@@ -0,0 +1,304 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Mode selects how a buffer handles output beyond its size limit
+type Mode string
+
+const (
+	// ModeTruncate keeps the first bytes up to the limit and discards the rest (default for stdout)
+	ModeTruncate Mode = "truncate"
+	// ModeSpill keeps the first bytes in memory and writes the rest to a temporary file
+	ModeSpill Mode = "spill"
+)
+
+// Output is a buffer capturing process output
+type Output interface {
+	io.Writer
+	// Bytes returns the captured content
+	Bytes() []byte
+	// String returns the captured content as a string
+	String() string
+	// Size returns the number of bytes kept
+	Size() int64
+	// Truncated returns whether content was discarded
+	Truncated() bool
+	// Reader returns a reader over the captured content
+	Reader() (io.ReadSeekCloser, error)
+	// Close releases resources such as spill files
+	Close() error
+}
+
+// Reader returns a reader over the buffer contents, including any truncation suffix
+func (lb *LimitedBuffer) Reader() (io.ReadSeekCloser, error) {
+	return nopCloser{bytes.NewReader(lb.Bytes())}, nil
+}
+
+// Close is a no-op; it lets LimitedBuffer be used as an Output
+func (lb *LimitedBuffer) Close() error {
+	return nil
+}
+
+// nopCloser adds a no-op Close to a ReadSeeker
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// NewStdoutOutput creates a stdout buffer using the configured StdoutMode (default ModeTruncate)
+func (bm *BufferManager) NewStdoutOutput() Output {
+	return bm.newOutput(bm.config.StdoutMode, ModeTruncate, bm.config.MaxStdoutSize)
+}
+
+// NewStderrOutput creates a stderr buffer using the configured StderrMode (default ModeRing)
+// so the final error message survives large outputs
+func (bm *BufferManager) NewStderrOutput() Output {
+	return bm.newOutput(bm.config.StderrMode, ModeRing, bm.config.MaxStderrSize)
+}
+
+// newOutput creates a buffer for the given mode and in-memory limit
+func (bm *BufferManager) newOutput(mode, defaultMode Mode, maxSize int64) Output {
+	if mode == "" {
+		mode = defaultMode
+	}
+	switch mode {
+	case ModeSpill:
+		return NewSpillBuffer(maxSize, bm.config.SpillDir, bm.config.MaxSpillSize)
+	case ModeRing:
+		return NewRingBuffer(maxSize, bm.config.RingHeadSize)
+	}
+	if bm.config.Recovery != nil {
+		return NewResilientBuffer(maxSize, bm.config.TruncationSuffix, bm.config.Recovery)
+	}
+	return NewLimitedBuffer(maxSize, bm.config.TruncationSuffix)
+}
+
+// SpillBuffer keeps the first bytes in memory and spills the rest to a temporary file
+// The file is created on the first write past the memory limit and removed by Close;
+// a finalizer removes it if the buffer is dropped without being closed
+type SpillBuffer struct {
+	mu        sync.RWMutex
+	mem       bytes.Buffer
+	memLimit  int64
+	dir       string
+	maxSize   int64
+	file      *os.File
+	written   int64
+	truncated bool
+	err       error
+	closed    bool
+}
+
+// NewSpillBuffer creates a spill buffer holding memLimit bytes in memory
+// Spill files are created in dir (os.TempDir when empty); maxSize caps the total size, 0 means no cap
+func NewSpillBuffer(memLimit int64, dir string, maxSize int64) *SpillBuffer {
+	sb := &SpillBuffer{memLimit: memLimit, dir: dir, maxSize: maxSize}
+	runtime.SetFinalizer(sb, (*SpillBuffer).Close)
+	return sb
+}
+
+// Write implements io.Writer, spilling to disk past the memory limit
+// Like LimitedBuffer it never fails the writer; spill errors are reported by Err
+func (sb *SpillBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	originalLen := len(p)
+	if sb.closed || sb.err != nil {
+		sb.truncated = true
+		return originalLen, nil
+	}
+
+	if sb.maxSize > 0 && sb.written+int64(len(p)) > sb.maxSize {
+		p = p[:max(sb.maxSize-sb.written, 0)]
+		sb.truncated = true
+	}
+
+	if room := sb.memLimit - int64(sb.mem.Len()); room > 0 {
+		n := min(room, int64(len(p)))
+		sb.mem.Write(p[:n])
+		sb.written += n
+		p = p[n:]
+	}
+
+	if len(p) > 0 {
+		if sb.file == nil {
+			file, err := os.CreateTemp(sb.dir, "claude-spill-*")
+			if err != nil {
+				sb.err = fmt.Errorf("failed to create spill file: %w", err)
+				sb.truncated = true
+				return originalLen, nil
+			}
+			sb.file = file
+		}
+		n, err := sb.file.Write(p)
+		sb.written += int64(n)
+		if err != nil {
+			sb.err = fmt.Errorf("failed to write spill file: %w", err)
+			sb.truncated = true
+		}
+	}
+
+	return originalLen, nil
+}
+
+// Reader returns a reader over the full content written so far
+// Readers stay valid after Close on systems that allow removing open files
+func (sb *SpillBuffer) Reader() (io.ReadSeekCloser, error) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	if sb.closed {
+		return nil, errors.New("spill buffer is closed")
+	}
+
+	r := &spillReader{
+		mem:  append([]byte(nil), sb.mem.Bytes()...),
+		size: sb.written,
+	}
+	if sb.file != nil {
+		file, err := os.Open(sb.file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open spill file: %w", err)
+		}
+		r.file = file
+	}
+	return r, nil
+}
+
+// Bytes reads the full content into memory
+func (sb *SpillBuffer) Bytes() []byte {
+	r, err := sb.Reader()
+	if err != nil {
+		sb.mu.RLock()
+		defer sb.mu.RUnlock()
+		return append([]byte(nil), sb.mem.Bytes()...)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	return data
+}
+
+// String returns the full content as a string
+func (sb *SpillBuffer) String() string {
+	return string(sb.Bytes())
+}
+
+// Size returns the total number of bytes kept in memory and on disk
+func (sb *SpillBuffer) Size() int64 {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.written
+}
+
+// Truncated returns whether content was discarded because of MaxSpillSize or a spill error
+func (sb *SpillBuffer) Truncated() bool {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.truncated
+}
+
+// Spilled returns whether content was written to disk
+func (sb *SpillBuffer) Spilled() bool {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.file != nil
+}
+
+// Err returns the error that stopped spilling, if any
+func (sb *SpillBuffer) Err() error {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.err
+}
+
+// Close removes the spill file; further writes are discarded
+func (sb *SpillBuffer) Close() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.closed {
+		return nil
+	}
+	sb.closed = true
+	runtime.SetFinalizer(sb, nil)
+
+	if sb.file == nil {
+		return nil
+	}
+	name := sb.file.Name()
+	closeErr := sb.file.Close()
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return closeErr
+}
+
+// spillReader reads the memory part followed by the spill file
+type spillReader struct {
+	mem  []byte
+	file *os.File
+	size int64
+	off  int64
+}
+
+// Read implements io.Reader
+func (r *spillReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if remaining := r.size - r.off; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	memLen := int64(len(r.mem))
+	if r.off < memLen {
+		n := copy(p, r.mem[r.off:])
+		r.off += int64(n)
+		return n, nil
+	}
+
+	n, err := r.file.ReadAt(p, r.off-memLen)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *spillReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.off + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("spill reader: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("spill reader: negative position")
+	}
+	r.off = abs
+	return abs, nil
+}
+
+// Close closes the reader's handle on the spill file
+func (r *spillReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,109 @@
+package buffer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	dir := t.TempDir()
+	sb := NewSpillBuffer(8, dir, 0)
+
+	content := strings.Repeat("0123456789", 10)
+	for i := 0; i < len(content); i += 7 {
+		end := min(i+7, len(content))
+		if n, err := sb.Write([]byte(content[i:end])); err != nil || n != end-i {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+	}
+
+	if !sb.Spilled() || sb.Truncated() || sb.Size() != int64(len(content)) {
+		t.Errorf("Expected %d bytes spilled without truncation, got size %d spilled %v truncated %v",
+			len(content), sb.Size(), sb.Spilled(), sb.Truncated())
+	}
+	if sb.String() != content {
+		t.Errorf("String() = %q, want %q", sb.String(), content)
+	}
+
+	r, err := sb.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	part := make([]byte, 10)
+	if _, err := io.ReadFull(r, part); err != nil || string(part) != content[5:15] {
+		t.Errorf("Read across memory and file = %q, %v, want %q", part, err, content[5:15])
+	}
+	r.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "claude-spill-*"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one spill file, got %v", files)
+	}
+	if err := sb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(files[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected spill file to be removed, got %v", err)
+	}
+	if _, err := sb.Reader(); err == nil {
+		t.Error("Expected Reader to fail after Close")
+	}
+}
+
+func TestSpillBuffer_Limits(t *testing.T) {
+	// Output that fits in memory never touches the disk
+	small := NewSpillBuffer(100, t.TempDir(), 0)
+	small.Write([]byte("hello"))
+	if small.Spilled() || small.String() != "hello" {
+		t.Errorf("Expected in-memory content, got spilled %v %q", small.Spilled(), small.String())
+	}
+	small.Close()
+
+	capped := NewSpillBuffer(4, t.TempDir(), 10)
+	defer capped.Close()
+	capped.Write([]byte("0123456789abcdef"))
+	if !capped.Truncated() || capped.String() != "0123456789" {
+		t.Errorf("Expected content capped at 10 bytes, got %q truncated %v", capped.String(), capped.Truncated())
+	}
+
+	missing := NewSpillBuffer(2, filepath.Join(t.TempDir(), "missing"), 0)
+	defer missing.Close()
+	missing.Write([]byte("abcdef"))
+	if !missing.Truncated() || missing.Err() == nil || missing.String() != "ab" {
+		t.Errorf("Expected spill failure to keep memory content, got %q err %v", missing.String(), missing.Err())
+	}
+}
+
+func TestBufferManager_Modes(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxStdoutSize = 4
+	config.StdoutMode = ModeSpill
+	config.SpillDir = t.TempDir()
+	bm := NewBufferManager(config)
+
+	stdout := bm.NewStdoutOutput()
+	defer stdout.Close()
+	stdout.Write([]byte("0123456789"))
+	if stdout.String() != "0123456789" || stdout.Truncated() {
+		t.Errorf("Expected spill mode to keep all output, got %q", stdout.String())
+	}
+
+	if _, ok := bm.NewStderrOutput().(*RingBuffer); !ok {
+		t.Errorf("Expected ring buffer for stderr by default, got %T", bm.NewStderrOutput())
+	}
+
+	// Empty modes fall back to the per-stream defaults
+	bare := NewBufferManager(&Config{MaxStdoutSize: 4, MaxStderrSize: 4})
+	if _, ok := bare.NewStdoutOutput().(*LimitedBuffer); !ok {
+		t.Errorf("Expected truncating buffer for stdout, got %T", bare.NewStdoutOutput())
+	}
+	if _, ok := bare.NewStderrOutput().(*RingBuffer); !ok {
+		t.Errorf("Expected ring buffer for stderr, got %T", bare.NewStderrOutput())
+	}
+}
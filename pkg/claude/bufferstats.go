@@ -0,0 +1,72 @@
+package claude
+
+import (
+	"time"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
+)
+
+// BufferStats describes the output buffers of one run
+type BufferStats struct {
+	StdoutBytes     int64
+	StderrBytes     int64
+	StdoutTruncated bool
+	StderrTruncated bool
+	// Writes is the number of writes to both buffers
+	Writes int64
+	// Truncations is the number of buffers that hit their size limit
+	Truncations int64
+	// FallbackUsed reports whether a ResilientBuffer switched to its fallback buffer
+	FallbackUsed bool
+}
+
+// WithBufferMonitor aggregates the buffer metrics of every run in monitor
+func WithBufferMonitor(monitor *buffer.Monitor) ClientOption {
+	return func(c *ClaudeClient) {
+		c.BufferMonitor = monitor
+	}
+}
+
+// monitorOutput wraps a run's buffer so its metrics are tracked and reported to the client's monitor
+func (c *ClaudeClient) monitorOutput(out buffer.Output) *buffer.MonitoredOutput {
+	return buffer.NewMonitoredOutput(out, c.BufferMonitor)
+}
+
+// newBufferStats summarizes the buffers of a run
+func newBufferStats(stdout, stderr *buffer.MonitoredOutput) *BufferStats {
+	stats := &BufferStats{
+		StdoutBytes:     stdout.Size(),
+		StderrBytes:     stderr.Size(),
+		StdoutTruncated: stdout.Truncated(),
+		StderrTruncated: stderr.Truncated(),
+		FallbackUsed:    stdout.FallbackUsed() || stderr.FallbackUsed(),
+	}
+	for _, m := range []buffer.Stats{stdout.GetMetrics(), stderr.GetMetrics()} {
+		stats.Writes += m.OperationCount
+		stats.Truncations += m.TotalTruncations
+	}
+	return stats
+}
+
+// Stats returns the buffer statistics of all runs since the client's BufferMonitor was created
+// It returns zero stats when the client has no BufferMonitor
+func (c *ClaudeClient) Stats() buffer.Stats {
+	if c.BufferMonitor == nil {
+		return buffer.Stats{}
+	}
+	return c.BufferMonitor.LifetimeStats()
+}
+
+// Health checks buffer health over the BufferMonitor's rolling window
+// Without a BufferMonitor there is nothing to judge and the client is reported healthy
+func (c *ClaudeClient) Health() buffer.HealthStatus {
+	if c.BufferMonitor == nil {
+		return buffer.HealthStatus{
+			IsHealthy:   true,
+			LastCheck:   time.Now(),
+			Issues:      []string{},
+			Suggestions: []string{"Use WithBufferMonitor to track buffer health"},
+		}
+	}
+	return c.BufferMonitor.Health()
+}
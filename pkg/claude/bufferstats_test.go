@@ -0,0 +1,53 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
+)
+
+func TestClient_BufferStatsAndHealth(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = mockExecCommandStderr("0123456789", "warning", 0)
+
+	monitor := buffer.NewMonitor(time.Minute)
+	client := NewClient("claude", WithBufferMonitor(monitor))
+
+	bufferConfig := buffer.DefaultConfig()
+	bufferConfig.MaxStdoutSize = 4
+	result, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: TextOutput, BufferConfig: bufferConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := result.BufferStats
+	if stats == nil {
+		t.Fatal("Expected buffer stats on the result")
+	}
+	if stats.StdoutBytes != 4 || !stats.StdoutTruncated || stats.Truncations != 1 || stats.StderrBytes != 7 || stats.Writes < 2 {
+		t.Errorf("Unexpected buffer stats: %+v", stats)
+	}
+
+	if lifetime := client.Stats(); lifetime.TotalBytesWritten != 17 || lifetime.TotalTruncations != 1 {
+		t.Errorf("Unexpected client stats: %+v", lifetime)
+	}
+	if health := client.Health(); !health.IsHealthy {
+		t.Errorf("Expected healthy client, got %+v", health)
+	}
+
+	// Without a monitor results still carry their own stats
+	plain := NewClient("claude")
+	result, _ = plain.RunPromptCtx(context.Background(), "test", &RunOptions{Format: TextOutput})
+	if result.BufferStats == nil || result.BufferStats.StdoutBytes != 10 {
+		t.Errorf("Expected per-run stats without a monitor, got %+v", result.BufferStats)
+	}
+	if !plain.Health().IsHealthy || plain.Stats().OperationCount != 0 {
+		t.Error("Expected empty stats and healthy status without a monitor")
+	}
+}
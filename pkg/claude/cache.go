@@ -0,0 +1,423 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheMode controls how a single run interacts with the client's result cache
+type CacheMode string
+
+const (
+	// CacheDefault returns cached results when available and stores new ones
+	CacheDefault CacheMode = ""
+	// CacheBypass neither reads nor writes the cache
+	CacheBypass CacheMode = "bypass"
+	// CacheRefresh ignores cached results but stores the new one
+	CacheRefresh CacheMode = "refresh"
+)
+
+// isValidCacheMode checks if the cache mode is supported
+func isValidCacheMode(mode CacheMode) bool {
+	switch mode {
+	case CacheDefault, CacheBypass, CacheRefresh:
+		return true
+	default:
+		return false
+	}
+}
+
+// CacheOptions configures a ResultCache
+type CacheOptions struct {
+	// Dir is the directory holding cache entries (created if missing)
+	Dir string
+	// TTL is how long entries stay valid; zero means entries never expire
+	TTL time.Duration
+	// MaxSize is the maximum total size of the cache in bytes; zero means unlimited
+	// The least recently used entries are evicted first
+	MaxSize int64
+	// CLIVersion overrides the CLI version used in cache keys
+	// When empty, the version reported by the client's binary is used
+	CLIVersion string
+}
+
+// CacheInfo describes how a result relates to the cache
+type CacheInfo struct {
+	// Hit is true when the result was served from the cache
+	Hit bool
+	// Key is the content address of the entry
+	Key string
+	// StoredAt is when the entry was written
+	StoredAt time.Time
+}
+
+// CacheEntry is a cached run as stored on disk
+type CacheEntry struct {
+	Key        string        `json:"key"`
+	CreatedAt  time.Time     `json:"created_at"`
+	CLIVersion string        `json:"cli_version"`
+	Result     *ClaudeResult `json:"result"`
+	// Transcript holds the raw stream-json output for stream runs
+	Transcript []byte `json:"transcript,omitempty"`
+}
+
+// Messages decodes the stored stream transcript
+func (e *CacheEntry) Messages() ([]Message, error) {
+	var messages []Message
+	decoder := NewStreamDecoder(bytes.NewReader(e.Transcript), len(e.Transcript)+1, StreamStrict)
+	defer decoder.Close()
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cached message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// ResultCache is a content-addressed on-disk cache of Claude results
+// It is safe for concurrent use by multiple goroutines
+type ResultCache struct {
+	opts CacheOptions
+	mu   sync.Mutex
+}
+
+// NewResultCache creates a cache in opts.Dir
+func NewResultCache(opts CacheOptions) (*ResultCache, error) {
+	if opts.Dir == "" {
+		return nil, NewValidationError("Cache directory is required", "Dir", opts.Dir)
+	}
+	if opts.TTL < 0 {
+		return nil, NewValidationError("Cache TTL cannot be negative", "TTL", opts.TTL)
+	}
+	if opts.MaxSize < 0 {
+		return nil, NewValidationError("Cache MaxSize cannot be negative", "MaxSize", opts.MaxSize)
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ResultCache{opts: opts}, nil
+}
+
+// WithCache enables result caching for RunPromptCtx and QuerySync
+func WithCache(cache *ResultCache) ClientOption {
+	return func(c *ClaudeClient) {
+		c.Cache = cache
+	}
+}
+
+// entryPath returns the file holding the entry for key
+func (rc *ResultCache) entryPath(key string) string {
+	return filepath.Join(rc.opts.Dir, key+".json")
+}
+
+// Get returns the entry for key if it exists and has not expired
+func (rc *ResultCache) Get(key string) (*CacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	path := rc.entryPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Result == nil {
+		// Corrupt entries are dropped
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	if rc.opts.TTL > 0 && time.Since(entry.CreatedAt) > rc.opts.TTL {
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	// Touch the entry so eviction is least-recently-used
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return &entry, true
+}
+
+// Put stores an entry and evicts old entries if the cache exceeds MaxSize
+func (rc *ResultCache) Put(entry *CacheEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// Write atomically so concurrent readers never see partial entries
+	tmp, err := os.CreateTemp(rc.opts.Dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), rc.entryPath(entry.Key)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return rc.evict()
+}
+
+// Delete removes the entry for key
+func (rc *ResultCache) Delete(key string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	err := os.Remove(rc.entryPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Clear removes every entry from the cache
+func (rc *ResultCache) Clear() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	files, err := rc.entries()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the total size of all entries in bytes
+func (rc *ResultCache) Size() (int64, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	files, err := rc.entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	return total, nil
+}
+
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// entries lists the entry files in the cache directory
+func (rc *ResultCache) entries() ([]cacheFile, error) {
+	dirEntries, err := os.ReadDir(rc.opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var files []cacheFile
+	for _, de := range dirEntries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".json") {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cacheFile{
+			path:    filepath.Join(rc.opts.Dir, de.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	return files, nil
+}
+
+// evict removes least recently used entries until the cache fits in MaxSize
+func (rc *ResultCache) evict() error {
+	if rc.opts.MaxSize <= 0 {
+		return nil
+	}
+
+	files, err := rc.entries()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total <= rc.opts.MaxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if total <= rc.opts.MaxSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// Key computes the content address for a run from the prompt, the normalized
+// CLI arguments, the CLI version, the working directory, the environment options
+// and the contents of opts.CacheFiles
+func (rc *ResultCache) Key(prompt string, opts *RunOptions, cliVersion string) (string, error) {
+	h := sha256.New()
+	writeField := func(name, value string) {
+		fmt.Fprintf(h, "%s:%d:%s\n", name, len(value), value)
+	}
+
+	writeField("prompt", prompt)
+	for _, arg := range normalizeArgs(BuildArgs("", opts)) {
+		writeField("arg", arg)
+	}
+	writeField("cli_version", cliVersion)
+
+	// An empty WorkingDir runs in the process's directory, so runs from different directories get different keys
+	cwd, err := filepath.Abs(opts.WorkingDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+	writeField("cwd", cwd)
+
+	// The environment can change the CLI's behavior, e.g. the model or API endpoint
+	writeField("env_mode", string(opts.EnvMode))
+	allowlist := append([]string{}, opts.EnvAllowlist...)
+	sort.Strings(allowlist)
+	for _, name := range allowlist {
+		writeField("env_allow", name)
+	}
+	envKeys := make([]string, 0, len(opts.Env))
+	for name := range opts.Env {
+		envKeys = append(envKeys, name)
+	}
+	sort.Strings(envKeys)
+	for _, name := range envKeys {
+		writeField("env", name+"="+opts.Env[name])
+	}
+
+	files := append([]string{}, opts.CacheFiles...)
+	sort.Strings(files)
+	for _, name := range files {
+		path := name
+		if !filepath.IsAbs(path) && opts.WorkingDir != "" {
+			path = filepath.Join(opts.WorkingDir, path)
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash cache file %s: %w", name, err)
+		}
+		writeField("file", name+"="+sum)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalizeArgs makes equivalent argument lists compare equal by sorting tool lists
+func normalizeArgs(args []string) []string {
+	normalized := append([]string{}, args...)
+	for i := 0; i < len(normalized)-1; i++ {
+		switch normalized[i] {
+		case "--allowedTools", "--disallowedTools":
+			tools := strings.Split(normalized[i+1], ",")
+			sort.Strings(tools)
+			normalized[i+1] = strings.Join(tools, ",")
+		}
+	}
+	return normalized
+}
+
+// hashFile returns the hex SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheRef identifies the cache entry for a run
+type cacheRef struct {
+	key     string
+	version string
+}
+
+// cacheRefFor returns the cache entry reference for a run, or nil if the run must not be cached
+// Runs reading stdin or continuing the most recent conversation are never cached
+func (c *ClaudeClient) cacheRefFor(ctx context.Context, stdin io.Reader, prompt string, opts *RunOptions) (*cacheRef, error) {
+	if c.Cache == nil || opts.CacheMode == CacheBypass || stdin != nil || opts.Continue {
+		return nil, nil
+	}
+
+	version := c.Cache.opts.CLIVersion
+	if version == "" {
+		info, err := c.BinaryInfo(ctx)
+		if err != nil {
+			// Without a version we cannot tell whether a cached result is still valid
+			return nil, nil
+		}
+		version = info.Version.String()
+	}
+
+	key, err := c.Cache.Key(prompt, opts, version)
+	if err != nil {
+		return nil, NewValidationError(err.Error(), "CacheFiles", opts.CacheFiles)
+	}
+	return &cacheRef{key: key, version: version}, nil
+}
+
+// cachedResult returns a copy of the entry's result marked as a cache hit
+func (e *CacheEntry) cachedResult() *ClaudeResult {
+	result := *e.Result
+	result.Cache = &CacheInfo{Hit: true, Key: e.Key, StoredAt: e.CreatedAt}
+	return &result
+}
@@ -0,0 +1,211 @@
+package claude
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, opts CacheOptions) *ResultCache {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	if opts.CLIVersion == "" {
+		opts.CLIVersion = "1.0.0"
+	}
+	cache, err := NewResultCache(opts)
+	if err != nil {
+		t.Fatalf("NewResultCache failed: %v", err)
+	}
+	return cache
+}
+
+func TestResultCache_Key(t *testing.T) {
+	cache := newTestCache(t, CacheOptions{})
+
+	base, err := cache.Key("prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"}}, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tool order does not change the key
+	reordered, _ := cache.Key("prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Write", "Read"}}, "1.0.0")
+	if base != reordered {
+		t.Error("Expected tool order to be normalized")
+	}
+
+	// Prompt, options and CLI version do
+	for name, key := range map[string]string{
+		"prompt":  mustKey(t, cache, "other", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"}}, "1.0.0"),
+		"options": mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read"}}, "1.0.0"),
+		"version": mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"}}, "1.0.1"),
+		"env": mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"},
+			Env: map[string]string{"ANTHROPIC_MODEL": "opus"}}, "1.0.0"),
+		"env mode": mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"},
+			EnvMode: EnvModeAllowlist, EnvAllowlist: []string{"PATH"}}, "1.0.0"),
+	} {
+		if key == base {
+			t.Errorf("Expected %s to change the key", name)
+		}
+	}
+
+	// An empty WorkingDir is the process's directory
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit := mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"}, WorkingDir: wd}, "1.0.0")
+	if explicit != base {
+		t.Error("Expected an empty WorkingDir to resolve to the current directory")
+	}
+	t.Chdir(dir)
+	if mustKey(t, cache, "prompt", &RunOptions{Format: JSONOutput, AllowedTools: []string{"Read", "Write"}}, "1.0.0") == base {
+		t.Error("Expected runs from another directory to get another key")
+	}
+
+	// Referenced file contents are part of the key
+	file := filepath.Join(dir, "main.go")
+	os.WriteFile(file, []byte("package main"), 0644)
+	opts := &RunOptions{WorkingDir: dir, CacheFiles: []string{"main.go"}}
+	before := mustKey(t, cache, "prompt", opts, "1.0.0")
+	os.WriteFile(file, []byte("package main // changed"), 0644)
+	after := mustKey(t, cache, "prompt", opts, "1.0.0")
+	if before == after {
+		t.Error("Expected file contents to change the key")
+	}
+
+	if _, err := cache.Key("prompt", &RunOptions{CacheFiles: []string{filepath.Join(dir, "missing")}}, "1.0.0"); err == nil {
+		t.Error("Expected error for missing cache file")
+	}
+}
+
+func mustKey(t *testing.T, cache *ResultCache, prompt string, opts *RunOptions, version string) string {
+	t.Helper()
+	key, err := cache.Key(prompt, opts, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestResultCache_TTLAndEviction(t *testing.T) {
+	cache := newTestCache(t, CacheOptions{TTL: time.Hour})
+
+	cache.Put(&CacheEntry{Key: "fresh", Result: &ClaudeResult{Result: "fresh"}})
+	cache.Put(&CacheEntry{Key: "stale", Result: &ClaudeResult{Result: "stale"}, CreatedAt: time.Now().Add(-2 * time.Hour)})
+
+	if entry, ok := cache.Get("fresh"); !ok || entry.Result.Result != "fresh" {
+		t.Errorf("Expected fresh entry, got %v %v", entry, ok)
+	}
+	if _, ok := cache.Get("stale"); ok {
+		t.Error("Expected stale entry to be expired")
+	}
+
+	// Evict least recently used entries once MaxSize is exceeded
+	small := newTestCache(t, CacheOptions{})
+	small.Put(&CacheEntry{Key: "a", Result: &ClaudeResult{Result: "a"}})
+	size, _ := small.Size()
+	small.opts.MaxSize = size*2 + size/2
+
+	old := time.Now().Add(-time.Minute)
+	os.Chtimes(small.entryPath("a"), old, old)
+	small.Put(&CacheEntry{Key: "b", Result: &ClaudeResult{Result: "b"}})
+	small.Get("a") // touch a so b is the least recently used
+	small.Put(&CacheEntry{Key: "c", Result: &ClaudeResult{Result: "c"}})
+
+	if _, ok := small.Get("b"); ok {
+		t.Error("Expected least recently used entry b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := small.Get(key); !ok {
+			t.Errorf("Expected entry %s to remain", key)
+		}
+	}
+}
+
+func TestResultCache_Messages(t *testing.T) {
+	entry := &CacheEntry{Transcript: []byte(`{"type":"system","subtype":"init","session_id":"s1"}
+{"type":"result","result":"done","session_id":"s1"}
+`)}
+	messages, err := entry.Messages()
+	if err != nil {
+		t.Fatalf("Messages failed: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Result != "done" {
+		t.Errorf("Unexpected messages: %+v", messages)
+	}
+}
+
+func TestRunPromptCtx_Cache(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	calls := 0
+	jsonOutput := `{"type":"result","subtype":"success","cost_usd":0.5,"is_error":false,"num_turns":1,"result":"fresh","session_id":"abc"}`
+	mock := mockExecCommandContext(t, []string{"-p", "cached prompt", "--output-format", "json"}, jsonOutput, 0)
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		return mock(ctx, name, arg...)
+	}
+
+	client := NewClient("claude", WithCache(newTestCache(t, CacheOptions{})))
+	ctx := context.Background()
+
+	first, err := client.RunPromptCtx(ctx, "cached prompt", &RunOptions{Format: JSONOutput})
+	if err != nil {
+		t.Fatalf("First run failed: %v", err)
+	}
+	if first.Cache == nil || first.Cache.Hit {
+		t.Errorf("Expected stored cache miss, got %+v", first.Cache)
+	}
+
+	second, err := client.QuerySync(ctx, "cached prompt", QueryOptions{Format: JSONOutput})
+	if err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected cached result without running the CLI, got %d calls", calls)
+	}
+	if second.Cache == nil || !second.Cache.Hit || second.Cache.Key != first.Cache.Key {
+		t.Errorf("Expected cache hit, got %+v", second.Cache)
+	}
+	if second.Result != "fresh" || second.SessionID != "abc" || second.CostUSD != 0.5 {
+		t.Errorf("Unexpected cached result: %+v", second)
+	}
+
+	// Bypass runs the CLI without touching the cache
+	if _, err := client.RunPromptCtx(ctx, "cached prompt", &RunOptions{Format: JSONOutput, CacheMode: CacheBypass}); err != nil {
+		t.Fatal(err)
+	}
+	// Refresh runs the CLI and stores the new result
+	refreshed, err := client.RunPromptCtx(ctx, "cached prompt", &RunOptions{Format: JSONOutput, CacheMode: CacheRefresh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected bypass and refresh to run the CLI, got %d calls", calls)
+	}
+	if refreshed.Cache == nil || refreshed.Cache.Hit {
+		t.Errorf("Expected refreshed entry to be stored, got %+v", refreshed.Cache)
+	}
+
+	// Continuing the latest conversation is never cached
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		return mockExecCommandContext(t, []string{"-p", "cached prompt", "--output-format", "json", "--continue"}, jsonOutput, 0)(ctx, name, arg...)
+	}
+	continued, err := client.RunPromptCtx(ctx, "cached prompt", &RunOptions{Format: JSONOutput, Continue: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if continued.Cache != nil {
+		t.Errorf("Expected --continue runs to skip the cache, got %+v", continued.Cache)
+	}
+}
@@ -0,0 +1,117 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
+)
+
+// WithCircuitBreaker fails runs fast while breaker is open
+// Only retryable failures (network, rate limit, timeout, MCP connection) count towards tripping it
+func WithCircuitBreaker(breaker *buffer.CircuitBreaker) ClientOption {
+	return func(c *ClaudeClient) {
+		c.CircuitBreaker = breaker
+	}
+}
+
+// BeginLaunch is called before starting a Claude process
+// It waits for the client's rate limiter and returns an ErrorCircuitOpen error while the
+// circuit breaker is open; every successful call must be paired with EndLaunch
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) BeginLaunch(ctx context.Context) error {
+	if c.RateLimiter != nil {
+		if err := c.RateLimiter.Wait(ctx); err != nil {
+			return fmt.Errorf("rate limiter: %w", err)
+		}
+	}
+
+	if c.CircuitBreaker != nil {
+		if err := c.CircuitBreaker.Allow(); err != nil {
+			retryAfter := int(math.Ceil(c.CircuitBreaker.RetryAfter().Seconds()))
+			return &ClaudeError{
+				Type:    ErrorCircuitOpen,
+				Message: "Circuit breaker is open - recent Claude runs failed, not starting a new process",
+				Details: map[string]interface{}{
+					"suggestion":  "Wait for the service to recover; a probe run is allowed after the reset timeout",
+					"retry_after": retryAfter,
+				},
+				Original: err,
+			}
+		}
+	}
+
+	if c.Metrics != nil {
+		c.Metrics.processStarted()
+	}
+	return nil
+}
+
+// EndLaunch reports the outcome of a process started after BeginLaunch
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) EndLaunch(ctx context.Context, err error) {
+	if c.RateLimiter != nil {
+		c.RateLimiter.Observe(err)
+	}
+	if c.Metrics != nil {
+		c.Metrics.processEnded()
+	}
+
+	if c.CircuitBreaker == nil {
+		return
+	}
+
+	var claudeErr *ClaudeError
+	var notStarted *notStartedError
+	switch {
+	case errors.As(err, &notStarted):
+		// The CLI never ran, so the service was not reached
+		c.CircuitBreaker.RecordIgnored()
+	case canceledByCaller(ctx):
+		// Canceled runs say nothing about the health of the service
+		c.CircuitBreaker.RecordIgnored()
+	case err == nil:
+		c.CircuitBreaker.RecordSuccess()
+	case errors.As(err, &claudeErr):
+		if claudeErr.IsRetryable() {
+			c.CircuitBreaker.RecordFailure()
+		} else {
+			// The CLI reached the service; the failure is specific to this run
+			c.CircuitBreaker.RecordSuccess()
+		}
+	default:
+		c.CircuitBreaker.RecordIgnored()
+	}
+}
+
+// canceledByCaller reports whether ctx ended for a reason other than a RunOptions timeout
+// Watchdog timeouts end the run's context too, but count as failures like other timeouts
+func canceledByCaller(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	var timeoutErr *TimeoutError
+	return !errors.As(context.Cause(ctx), &timeoutErr)
+}
+
+// notStartedError marks a failure before the Claude process started, such as a missing CLI
+type notStartedError struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *notStartedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *notStartedError) Unwrap() error {
+	return e.err
+}
+
+// notStarted wraps an error passed to EndLaunch for a process that never started
+func notStarted(err error) error {
+	return &notStartedError{err: err}
+}
@@ -0,0 +1,174 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
+)
+
+func TestRunPromptCtx_CircuitBreaker(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	calls := 0
+	stderr := "network error: connection refused"
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		return mockExecCommandStderr("", stderr, 1)(ctx, name, arg...)
+	}
+
+	breaker := buffer.NewCircuitBreaker(2, 50*time.Millisecond)
+	var states []buffer.CircuitState
+	breaker.OnStateChange(func(from, to buffer.CircuitState) {
+		states = append(states, to)
+	})
+
+	client := NewClient("claude", WithCircuitBreaker(breaker))
+	ctx := context.Background()
+	opts := &RunOptions{Format: JSONOutput}
+
+	for i := 0; i < 2; i++ {
+		client.RunPromptCtx(ctx, "test", opts)
+	}
+
+	// The open circuit fails fast without spawning a process
+	_, err := client.RunPromptCtx(ctx, "test", opts)
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorCircuitOpen {
+		t.Fatalf("Expected circuit open error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected no launch while open, got %d calls", calls)
+	}
+	if !errors.Is(err, buffer.ErrCircuitOpen) {
+		t.Error("Expected circuit open error to wrap buffer.ErrCircuitOpen")
+	}
+
+	// After the reset timeout a probe runs; non-retryable failures mean the service is reachable
+	time.Sleep(60 * time.Millisecond)
+	stderr = "Error: permission denied for tool Bash"
+	client.RunPromptCtx(ctx, "test", opts)
+	if calls != 3 || breaker.GetState() != buffer.StateClosed {
+		t.Errorf("Expected probe to close the circuit, got state %v after %d calls", breaker.GetState(), calls)
+	}
+
+	want := []buffer.CircuitState{buffer.StateOpen, buffer.StateHalfOpen, buffer.StateClosed}
+	if len(states) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("Transition %d = %v, want %v", i, states[i], want[i])
+		}
+	}
+}
+
+func TestEndLaunch_CircuitBreakerOutcomes(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOut, cancelTimeout := context.WithCancelCause(context.Background())
+	cancelTimeout(&TimeoutError{Kind: TimeoutIdle, Limit: time.Second})
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		err          error
+		wantFailures int64
+		wantSuccess  int64
+	}{
+		{"success", context.Background(), nil, 0, 1},
+		{"retryable error", context.Background(), NewClaudeError(ErrorNetwork, "reset"), 1, 0},
+		{"non-retryable error", context.Background(), NewClaudeError(ErrorPermission, "denied"), 0, 1},
+		{"plain error", context.Background(), errors.New("exec failed"), 0, 0},
+		{"canceled", canceled, NewClaudeError(ErrorNetwork, "reset"), 0, 0},
+		{"watchdog timeout", timedOut, NewClaudeError(ErrorTimeout, "idle"), 1, 0},
+		{"not started", context.Background(), notStarted(NewClaudeError(ErrorValidation, "CLI not found")), 0, 0},
+		{"MCP connection error", context.Background(), ParseError("Error: Failed to connect to MCP server: connection refused", 1), 1, 0},
+		{"MCP config error", context.Background(), ParseError("Error: MCP config file invalid: parse error", 1), 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := buffer.NewCircuitBreaker(5, time.Minute)
+			client := NewClient("claude", WithCircuitBreaker(breaker))
+
+			if err := client.BeginLaunch(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			client.EndLaunch(tt.ctx, tt.err)
+
+			m := breaker.Metrics()
+			if m.Failures != tt.wantFailures || m.Successes != tt.wantSuccess {
+				t.Errorf("Expected %d failures and %d successes, got %+v", tt.wantFailures, tt.wantSuccess, m)
+			}
+		})
+	}
+}
+
+func TestRunPromptCtx_CircuitBreakerCountsTimeouts(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecScript("exec sleep 5")
+
+	breaker := buffer.NewCircuitBreaker(1, time.Minute)
+	client := NewClient("claude", WithCircuitBreaker(breaker))
+
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput, Timeout: 50 * time.Millisecond})
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorTimeout {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if m := breaker.Metrics(); m.Failures != 1 || breaker.GetState() != buffer.StateOpen {
+		t.Errorf("Expected the timeout to trip the breaker, got %+v in state %v", m, breaker.GetState())
+	}
+}
+
+func TestRunPromptCtx_CircuitBreakerIgnoresMCPConfigErrors(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecCommandStderr("", "Error: MCP config file invalid: parse error", 1)
+
+	breaker := buffer.NewCircuitBreaker(1, time.Minute)
+	client := NewClient("claude", WithCircuitBreaker(breaker))
+
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput})
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorMCP || claudeErr.IsRetryable() {
+		t.Fatalf("Expected a non-retryable MCP error, got %v", err)
+	}
+	if m := breaker.Metrics(); m.Failures != 0 || breaker.GetState() != buffer.StateClosed {
+		t.Errorf("Expected a config error to leave the breaker closed, got %+v in state %v", m, breaker.GetState())
+	}
+}
+
+func TestRunPromptCtx_CircuitOpenIsReported(t *testing.T) {
+	breaker := buffer.NewCircuitBreaker(1, time.Minute)
+	breaker.RecordFailure()
+	metrics := NewClientMetrics()
+	client := NewClient("claude", WithCircuitBreaker(breaker), WithMetrics(metrics))
+
+	if _, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected circuit open error, got %v", err)
+	}
+	if _, err := collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{})); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected circuit open error from the stream, got %v", err)
+	}
+
+	// Rejected launches are reported like any other failed invocation
+	var buf strings.Builder
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `claude_errors_total{type="circuit_open"} 2`) {
+		t.Errorf("Expected both rejections in the metrics, got\n%s", buf.String())
+	}
+}
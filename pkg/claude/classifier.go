@@ -0,0 +1,442 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ClassifierRule maps a CLI failure to an error type
+//
+// A rule applies when its exit code filter passes and at least one of its matchers
+// (Patterns, APIErrorTypes, StatusCodes) matches; a rule without matchers applies on exit
+// code alone. RequirePatterns must all match in addition.
+type ClassifierRule struct {
+	// Name identifies the rule in Explain output
+	Name string `json:"name"`
+	// Type is the error type produced by the rule
+	Type ErrorType `json:"type"`
+	// Patterns are case-insensitive regular expressions matched against stderr
+	Patterns []string `json:"patterns,omitempty"`
+	// RequirePatterns must all match as well (e.g. an MCP error that is also a connection error)
+	RequirePatterns []string `json:"require_patterns,omitempty"`
+	// ExitCodes restricts the rule to these exit codes
+	ExitCodes []int `json:"exit_codes,omitempty"`
+	// APIErrorTypes match the error type of a JSON API error body, e.g. "overloaded_error"
+	APIErrorTypes []string `json:"api_error_types,omitempty"`
+	// StatusCodes match the HTTP status in messages such as "API Error: 529 {...}"
+	StatusCodes []int `json:"status_codes,omitempty"`
+	// Message is the ClaudeError message
+	Message string `json:"message"`
+	// Suggestion is stored in Details["suggestion"]
+	Suggestion string `json:"suggestion,omitempty"`
+	// RetryAfter extracts a retry delay from stderr into Details["retry_after"]
+	RetryAfter bool `json:"retry_after,omitempty"`
+
+	patterns []*regexp.Regexp
+	required []*regexp.Regexp
+}
+
+// compile prepares the rule's regular expressions
+func (r *ClassifierRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("classifier rule requires a name")
+	}
+	compileAll := func(patterns []string) ([]*regexp.Regexp, error) {
+		compiled := make([]*regexp.Regexp, 0, len(patterns))
+		for _, p := range patterns {
+			re, err := regexp.Compile("(?i)" + p)
+			if err != nil {
+				return nil, fmt.Errorf("classifier rule %q: invalid pattern %q: %w", r.Name, p, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	var err error
+	if r.patterns, err = compileAll(r.Patterns); err != nil {
+		return err
+	}
+	r.required, err = compileAll(r.RequirePatterns)
+	return err
+}
+
+// failure is the parsed form of a CLI failure that rules are matched against
+type failure struct {
+	stderr       string
+	exitCode     int
+	statusCode   int
+	apiErrorType string
+	apiMessage   string
+}
+
+// apiStatusPattern finds the HTTP status in "API Error: 529 ..." messages
+var apiStatusPattern = regexp.MustCompile(`(?i)api error:?\s*(\d{3})\b`)
+
+// parseFailure extracts the HTTP status and JSON error body from stderr when present
+func parseFailure(stderr string, exitCode int) failure {
+	f := failure{stderr: stderr, exitCode: exitCode}
+
+	if m := apiStatusPattern.FindStringSubmatch(stderr); m != nil {
+		f.statusCode, _ = strconv.Atoi(m[1])
+	}
+
+	if start, end := strings.Index(stderr, "{"), strings.LastIndex(stderr, "}"); start >= 0 && end > start {
+		var body struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal([]byte(stderr[start:end+1]), &body) == nil {
+			f.apiErrorType = body.Error.Type
+			f.apiMessage = body.Error.Message
+		}
+	}
+
+	return f
+}
+
+// match reports whether the rule applies and describes what matched
+func (r *ClassifierRule) match(f failure) (bool, string) {
+	if len(r.ExitCodes) > 0 && !containsInt(r.ExitCodes, f.exitCode) {
+		return false, ""
+	}
+	for _, re := range r.required {
+		if !re.MatchString(f.stderr) {
+			return false, ""
+		}
+	}
+
+	for _, re := range r.patterns {
+		if loc := re.FindStringIndex(f.stderr); loc != nil {
+			return true, fmt.Sprintf("pattern %q matched %q", strings.TrimPrefix(re.String(), "(?i)"), f.stderr[loc[0]:loc[1]])
+		}
+	}
+	for _, t := range r.APIErrorTypes {
+		if f.apiErrorType != "" && strings.EqualFold(t, f.apiErrorType) {
+			return true, fmt.Sprintf("API error type %q", f.apiErrorType)
+		}
+	}
+	if f.statusCode != 0 && containsInt(r.StatusCodes, f.statusCode) {
+		return true, fmt.Sprintf("HTTP status %d", f.statusCode)
+	}
+
+	if len(r.patterns) == 0 && len(r.APIErrorTypes) == 0 && len(r.StatusCodes) == 0 {
+		return true, fmt.Sprintf("exit code %d", f.exitCode)
+	}
+	return false, ""
+}
+
+// build creates the ClaudeError for a failure matched by the rule
+func (r *ClassifierRule) build(f failure) *ClaudeError {
+	details := map[string]interface{}{
+		"stderr": f.stderr,
+		// The rule name tells apart errors of the same type, e.g. MCP connection and config errors
+		"classifier_rule": r.Name,
+	}
+	if r.Suggestion != "" {
+		details["suggestion"] = r.Suggestion
+	}
+	if r.RetryAfter {
+		if retryAfter := extractRetryAfter(f.stderr); retryAfter > 0 {
+			details["retry_after"] = retryAfter
+		}
+	}
+	if f.apiErrorType != "" {
+		details["api_error_type"] = f.apiErrorType
+	}
+	if f.apiMessage != "" {
+		details["api_message"] = f.apiMessage
+	}
+	if f.statusCode != 0 {
+		details["status_code"] = f.statusCode
+	}
+
+	return &ClaudeError{
+		Type:    r.Type,
+		Message: r.Message,
+		Code:    f.exitCode,
+		Details: details,
+	}
+}
+
+// containsInt returns true if values contains v
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Classification explains how a failure was classified
+type Classification struct {
+	// Rule is the name of the matching rule, or empty when no rule matched
+	Rule string
+	// Type is the resulting error type
+	Type ErrorType
+	// Reason describes what matched
+	Reason string
+	// Error is the resulting ClaudeError
+	Error *ClaudeError
+}
+
+// ErrorClassifier turns CLI failures into ClaudeErrors using ordered rules; the first match wins
+// It is safe for concurrent use by multiple goroutines
+type ErrorClassifier struct {
+	mu    sync.RWMutex
+	rules []ClassifierRule
+}
+
+// DefaultErrorClassifier is used by ParseError and by clients without their own classifier
+// Rules registered on it apply process-wide
+var DefaultErrorClassifier = NewDefaultErrorClassifier()
+
+// NewErrorClassifier creates a classifier with the given rules in priority order
+func NewErrorClassifier(rules ...ClassifierRule) (*ErrorClassifier, error) {
+	c := &ErrorClassifier{}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// NewDefaultErrorClassifier creates a classifier with the built-in rules
+func NewDefaultErrorClassifier() *ErrorClassifier {
+	c, err := NewErrorClassifier(DefaultClassifierRules()...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// WithErrorClassifier classifies the client's CLI failures with classifier instead of DefaultErrorClassifier
+func WithErrorClassifier(classifier *ErrorClassifier) ClientOption {
+	return func(c *ClaudeClient) {
+		c.ErrorClassifier = classifier
+	}
+}
+
+// Register adds rules ahead of the existing ones so they take precedence
+func (c *ErrorClassifier) Register(rules ...ClassifierRule) error {
+	compiled := make([]ClassifierRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return err
+		}
+		compiled = append(compiled, rule)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append(compiled, c.rules...)
+	return nil
+}
+
+// LoadRules registers rules from a JSON file holding an array of rules, or an object with a "rules" array
+// Error types are given by name, e.g. {"name": "proxy", "type": "network", "patterns": ["proxy error"]}
+func (c *ErrorClassifier) LoadRules(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read classifier rules: %w", err)
+	}
+
+	var rules []ClassifierRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		var wrapper struct {
+			Rules []ClassifierRule `json:"rules"`
+		}
+		if wrapErr := json.Unmarshal(data, &wrapper); wrapErr != nil {
+			return fmt.Errorf("failed to parse classifier rules: %w", err)
+		}
+		rules = wrapper.Rules
+	}
+
+	return c.Register(rules...)
+}
+
+// Rules returns a copy of the rules in priority order
+func (c *ErrorClassifier) Rules() []ClassifierRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]ClassifierRule(nil), c.rules...)
+}
+
+// Classify converts stderr output and exit code into a ClaudeError
+func (c *ErrorClassifier) Classify(stderr string, exitCode int) *ClaudeError {
+	return c.Explain(stderr, exitCode).Error
+}
+
+// Explain classifies a failure and reports which rule matched and why
+func (c *ErrorClassifier) Explain(stderr string, exitCode int) *Classification {
+	f := parseFailure(strings.TrimSpace(stderr), exitCode)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if ok, reason := rule.match(f); ok {
+			return &Classification{Rule: rule.Name, Type: rule.Type, Reason: reason, Error: rule.build(f)}
+		}
+	}
+
+	claudeErr := genericCommandError(f)
+	return &Classification{Type: claudeErr.Type, Reason: "no rule matched", Error: claudeErr}
+}
+
+// ParseRunError classifies the failure of a Claude process with this classifier
+// See the package-level ParseRunError
+func (c *ErrorClassifier) ParseRunError(ctx context.Context, runErr error, stderr string) *ClaudeError {
+	return parseRunError(ctx, runErr, stderr, c)
+}
+
+// genericCommandError is used when no rule matches, with the first stderr line as the message
+func genericCommandError(f failure) *ClaudeError {
+	message := "Command execution failed"
+	if f.stderr != "" {
+		// Use first line of stderr as the primary message
+		lines := strings.Split(f.stderr, "\n")
+		if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+			message = strings.TrimSpace(lines[0])
+		}
+	}
+
+	return &ClaudeError{
+		Type:    ErrorCommand,
+		Message: message,
+		Code:    f.exitCode,
+		Details: map[string]interface{}{
+			"stderr": f.stderr,
+		},
+	}
+}
+
+// ClassifyRunError classifies the failure of a Claude process with the client's classifier
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) ClassifyRunError(ctx context.Context, runErr error, stderr string) *ClaudeError {
+	classifier := c.ErrorClassifier
+	if classifier == nil {
+		classifier = DefaultErrorClassifier
+	}
+	return classifier.ParseRunError(ctx, runErr, stderr)
+}
+
+// DefaultClassifierRules returns the built-in rules in priority order
+func DefaultClassifierRules() []ClassifierRule {
+	return []ClassifierRule{
+		{
+			Name:          "authentication",
+			Type:          ErrorAuthentication,
+			Patterns:      []string{`authentication`, `api key`, `unauthorized`, `\b401\b`, `forbidden`, `\b403\b`, `anthropic_api_key`},
+			APIErrorTypes: []string{"authentication_error", "permission_error"},
+			StatusCodes:   []int{401, 403},
+			Message:       "Authentication failed - check ANTHROPIC_API_KEY environment variable",
+			Suggestion:    "Verify your API key is valid and has necessary permissions",
+		},
+		{
+			// API overload (HTTP 529) is checked before rate limits since both ask to back off
+			Name:          "overloaded",
+			Type:          ErrorOverloaded,
+			Patterns:      []string{`overloaded`, `\b529\b`, `server is busy`},
+			APIErrorTypes: []string{"overloaded_error"},
+			StatusCodes:   []int{529},
+			Message:       "API is overloaded - please retry shortly",
+			Suggestion:    "The API is temporarily overloaded; retry after a short delay",
+			RetryAfter:    true,
+		},
+		{
+			Name:       "context_window",
+			Type:       ErrorContextWindow,
+			Patterns:   []string{`prompt is too long`, `context window`, `context length`, `maximum context`, `exceed context limit`, `too many tokens`},
+			Message:    "Prompt exceeds the model's context window",
+			Suggestion: "Shorten the prompt, start a new session or compact the conversation",
+		},
+		{
+			Name:          "rate_limit",
+			Type:          ErrorRateLimit,
+			Patterns:      []string{`rate limit`, `too many requests`, `\b429\b`, `quota exceeded`, `request limit`, `usage limit`},
+			APIErrorTypes: []string{"rate_limit_error"},
+			StatusCodes:   []int{429},
+			Message:       "Rate limit exceeded - please wait before retrying",
+			Suggestion:    "Wait before retrying or reduce request frequency",
+			RetryAfter:    true,
+		},
+		{
+			Name:       "permission",
+			Type:       ErrorPermission,
+			Patterns:   []string{`permission denied`, `not allowed`, `tool not permitted`, `access denied`, `insufficient permissions`, `unauthorized tool`},
+			Message:    "Tool usage not permitted - check allowed/disallowed tools configuration",
+			Suggestion: "Update --allowedTools or permissions settings",
+		},
+		// MCP errors are checked before network errors since MCP can have connection issues too
+		{
+			Name:            "mcp_connection",
+			Type:            ErrorMCP,
+			Patterns:        mcpPatterns,
+			RequirePatterns: []string{`connect|unreachable|timeout|refused`},
+			Message:         "MCP server error",
+			Suggestion:      "MCP server connection failed - ensure server is running and accessible",
+		},
+		{
+			Name:            "mcp_config",
+			Type:            ErrorMCP,
+			Patterns:        mcpPatterns,
+			RequirePatterns: []string{`config|invalid|not found|parse`},
+			Message:         "MCP server error",
+			Suggestion:      "MCP configuration error - check your MCP config file",
+		},
+		{
+			Name:       "mcp",
+			Type:       ErrorMCP,
+			Patterns:   mcpPatterns,
+			Message:    "MCP server error",
+			Suggestion: "Check MCP server configuration and ensure servers are running",
+		},
+		{
+			Name:       "network",
+			Type:       ErrorNetwork,
+			Patterns:   []string{`network`, `connection`, `timeout`, `dns`, `unreachable`, `socket`, `no internet`, `econnreset`, `econnrefused`, `enotfound`},
+			Message:    "Network connectivity issue",
+			Suggestion: "Check internet connection and try again",
+		},
+		{
+			Name:       "timeout",
+			Type:       ErrorTimeout,
+			Patterns:   []string{`timeout`, `timed out`, `deadline exceeded`},
+			Message:    "Operation timed out",
+			Suggestion: "Increase timeout or try a simpler operation",
+		},
+		{
+			Name:       "session",
+			Type:       ErrorSession,
+			Patterns:   []string{`session`, `resume`, `conversation not found`},
+			Message:    "Session management error",
+			Suggestion: "Check session ID or start a new conversation",
+		},
+		{
+			Name:          "validation",
+			Type:          ErrorValidation,
+			Patterns:      []string{`invalid`, `validation`, `malformed`, `bad request`, `\b400\b`, `unknown (option|argument|flag)`},
+			APIErrorTypes: []string{"invalid_request_error"},
+			StatusCodes:   []int{400},
+			Message:       "Input validation failed",
+			Suggestion:    "Check command arguments and options",
+		},
+	}
+}
+
+// mcpPatterns identify MCP server failures
+var mcpPatterns = []string{`mcp`, `model context protocol`, `server error`, `protocol error`}
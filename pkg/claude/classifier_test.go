@@ -0,0 +1,124 @@
+package claude
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorClassifier_Explain(t *testing.T) {
+	classifier := NewDefaultErrorClassifier()
+
+	tests := []struct {
+		name     string
+		stderr   string
+		exitCode int
+		wantRule string
+		wantType ErrorType
+	}{
+		{"rate limit pattern", "Error: Rate limit exceeded", 1, "rate_limit", ErrorRateLimit},
+		{"overloaded API body", `API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 1, "overloaded", ErrorOverloaded},
+		{"API error type without keywords", `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`, 1, "rate_limit", ErrorRateLimit},
+		{"MCP connection", "Error: Failed to connect to MCP server: connection refused", 1, "mcp_connection", ErrorMCP},
+		{"MCP config", "Error: Invalid MCP configuration file format", 1, "mcp_config", ErrorMCP},
+		{"no match", "Error: Unknown command failed", 1, "", ErrorCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := classifier.Explain(tt.stderr, tt.exitCode)
+			if c.Rule != tt.wantRule || c.Type != tt.wantType || c.Error.Type != tt.wantType {
+				t.Errorf("Explain() = rule %q type %v, want rule %q type %v", c.Rule, c.Type, tt.wantRule, tt.wantType)
+			}
+			if c.Reason == "" {
+				t.Error("Expected a reason")
+			}
+		})
+	}
+
+	c := classifier.Explain(`API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, 1)
+	if c.Error.Details["api_error_type"] != "overloaded_error" || c.Error.Details["status_code"] != 529 {
+		t.Errorf("Expected API error details, got %v", c.Error.Details)
+	}
+}
+
+func TestErrorClassifier_Register(t *testing.T) {
+	classifier := NewDefaultErrorClassifier()
+	err := classifier.Register(ClassifierRule{
+		Name:     "proxy",
+		Type:     ErrorNetwork,
+		Patterns: []string{`proxy error`},
+		Message:  "Proxy failure",
+	}, ClassifierRule{
+		Name:      "exit 137",
+		Type:      ErrorCanceled,
+		ExitCodes: []int{137},
+		Message:   "Process was killed",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registered rules take precedence over the defaults
+	if got := classifier.Explain("Error: proxy error (authentication required)", 1); got.Rule != "proxy" || got.Error.Message != "Proxy failure" {
+		t.Errorf("Expected proxy rule, got %q", got.Rule)
+	}
+	if got := classifier.Classify("", 137); got.Type != ErrorCanceled {
+		t.Errorf("Expected exit code rule to apply, got %v", got.Type)
+	}
+	if got := NewDefaultErrorClassifier().Classify("Error: proxy error", 1); got.Type != ErrorCommand {
+		t.Errorf("Expected other classifiers to be unaffected, got %v", got.Type)
+	}
+
+	if err := classifier.Register(ClassifierRule{Name: "bad", Patterns: []string{"("}}); err == nil {
+		t.Error("Expected invalid pattern to be rejected")
+	}
+	if err := classifier.Register(ClassifierRule{Patterns: []string{"x"}}); err == nil {
+		t.Error("Expected unnamed rule to be rejected")
+	}
+}
+
+func TestErrorClassifier_LoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `{"rules": [{"name": "gateway", "type": "network", "status_codes": [502, 504], "message": "Gateway error"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	classifier := NewDefaultErrorClassifier()
+	if err := classifier.LoadRules(path); err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	got := classifier.Explain("API Error: 502 Bad Gateway", 1)
+	if got.Rule != "gateway" || got.Type != ErrorNetwork || got.Reason != "HTTP status 502" {
+		t.Errorf("Expected gateway rule, got %+v", got)
+	}
+
+	if err := classifier.LoadRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestWithErrorClassifier(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = mockExecCommandStderr("", "Error: upstream proxy error", 1)
+
+	classifier := NewDefaultErrorClassifier()
+	classifier.Register(ClassifierRule{Name: "proxy", Type: ErrorNetwork, Patterns: []string{`proxy error`}, Message: "Proxy failure"})
+
+	client := NewClient("claude", WithErrorClassifier(classifier))
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput})
+	claudeErr, ok := err.(*ClaudeError)
+	if !ok || claudeErr.Type != ErrorNetwork {
+		t.Fatalf("Expected network error from client classifier, got %v", err)
+	}
+	if _, ok := claudeErr.Original.(*exec.ExitError); !ok {
+		t.Errorf("Expected original exit error, got %T", claudeErr.Original)
+	}
+}
@@ -1,14 +1,16 @@
 package claude
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
+	"log/slog"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
@@ -35,8 +37,35 @@ type ClaudeClient struct {
 	BinPath string
 	// DefaultOptions are the default options to use for all requests
 	DefaultOptions *RunOptions
+	// Cache stores results on disk for RunPromptCtx and QuerySync (optional)
+	Cache *ResultCache
+	// VersionConstraint pins the CLI to a version range (e.g. ">=1.0.0 <2.0.0")
+	// When set, the binary is verified before the first run
+	VersionConstraint string
+	// RateLimiter gates process launches and adapts to rate limit errors (optional)
+	RateLimiter *RateLimiter
+	// RetryBudget limits retries across all requests made with this client (optional)
+	RetryBudget *RetryBudget
+	// CircuitBreaker fails fast after repeated retryable failures (optional)
+	CircuitBreaker *buffer.CircuitBreaker
+	// ErrorClassifier classifies CLI failures; DefaultErrorClassifier is used when nil
+	ErrorClassifier *ErrorClassifier
+	// Logger receives a record for every CLI invocation (optional)
+	Logger *slog.Logger
+	// Tracer records a span per run with child spans per turn and tool use (optional)
+	Tracer Tracer
+	// Metrics collects invocation, error, latency, cost and retry metrics (optional)
+	Metrics *ClientMetrics
+	// BufferMonitor aggregates buffer metrics across runs for Stats and Health (optional)
+	BufferMonitor *buffer.Monitor
+
+	binaryMu sync.Mutex
+	binary   *BinaryInfo
 }
 
+// ClientOption configures optional ClaudeClient behavior in NewClient
+type ClientOption func(*ClaudeClient)
+
 // RunOptions configures how Claude Code is executed
 type RunOptions struct {
 	// Format specifies the output format (text, json, stream-json)
@@ -71,6 +100,11 @@ type RunOptions struct {
 	ModelAlias string
 	// Timeout specifies the maximum duration for command execution
 	Timeout time.Duration
+	// StartupTimeout kills the process if it writes nothing to stdout within this duration
+	StartupTimeout time.Duration
+	// IdleTimeout kills the process if it writes no output for this duration
+	// Text and JSON output only arrive when the run ends, so both are mainly useful with StreamJSONOutput
+	IdleTimeout time.Duration
 	// ConfigFile specifies path to Claude configuration file
 	ConfigFile string
 	// Help shows help information
@@ -82,11 +116,43 @@ type RunOptions struct {
 	// Theme specifies the UI theme
 	Theme string
 	
+	// PermissionMode sets the CLI permission mode (default, acceptEdits, plan, bypassPermissions)
+	PermissionMode PermissionMode
+	// MCPServers defines MCP servers inline; they are passed to the CLI as a JSON --mcp-config
+	MCPServers map[string]MCPServerConfig
+	// Settings is a path to a settings file or an inline JSON settings string
+	Settings string
+	// MaxThinkingTokens limits the number of tokens used for extended thinking
+	MaxThinkingTokens int
+	// ExtraArgs passes arbitrary CLI flags (without the leading "--"); a nil value emits a bare flag
+	ExtraArgs map[string]*string
+
+	// Execution environment, applied to every process the client launches
+	// WorkingDir is the directory Claude runs in (defaults to the current directory)
+	WorkingDir string
+	// Env sets additional environment variables for the Claude process
+	Env map[string]string
+	// EnvMode controls inheritance of the parent environment (inherit, clean, allowlist)
+	EnvMode EnvMode
+	// EnvAllowlist names the parent variables passed through in allowlist mode
+	EnvAllowlist []string
+	// AddDirs lists additional directories Claude may access besides the working directory
+	AddDirs []string
+
+	// CacheMode controls use of the client's result cache for this run
+	CacheMode CacheMode
+	// CacheFiles lists files whose contents are part of the cache key
+	// Relative paths are resolved against WorkingDir
+	CacheFiles []string
+
 	// Buffer configuration for output handling
 	BufferConfig *buffer.Config
+	// StreamMode controls how StreamPrompt handles stdout lines that are not messages (default StreamTolerant)
+	StreamMode StreamMode
 	
 	// Parsed tool permissions (computed from AllowedTools/DisallowedTools)
 	// This field is populated automatically and should not be set directly
+	// Use PolicyFromRunOptions to evaluate tool uses against these rules
 	ParsedAllowedTools    []ToolPermission `json:"-"`
 	ParsedDisallowedTools []ToolPermission `json:"-"`
 }
@@ -102,28 +168,135 @@ type ClaudeResult struct {
 	IsError       bool    `json:"is_error"`
 	NumTurns      int     `json:"num_turns"`
 	SessionID     string  `json:"session_id"`
+	Usage         *Usage  `json:"usage,omitempty"`
+
+	// Cache describes the cache entry for this result when the client has a cache
+	Cache *CacheInfo `json:"-"`
+	// BufferStats describes the output buffers of the run that produced this result
+	BufferStats *BufferStats `json:"-"`
+}
+
+// Usage reports the tokens used by a run
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens,omitempty"`
+}
+
+// PermissionMode controls how the CLI handles tool permission prompts
+type PermissionMode string
+
+const (
+	// PermissionModeDefault uses the CLI's standard permission prompts
+	PermissionModeDefault PermissionMode = "default"
+	// PermissionModeAcceptEdits automatically accepts file edits
+	PermissionModeAcceptEdits PermissionMode = "acceptEdits"
+	// PermissionModePlan lets Claude analyze and plan without modifying anything
+	PermissionModePlan PermissionMode = "plan"
+	// PermissionModeBypassPermissions skips all permission prompts
+	PermissionModeBypassPermissions PermissionMode = "bypassPermissions"
+)
+
+// MCPServerConfig describes a single MCP server (matches Python SDK McpServerConfig)
+// Stdio servers use Command/Args/Env, while "sse" and "http" servers use URL/Headers
+type MCPServerConfig struct {
+	Type    string            `json:"type,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 // QueryOptions aligns with Python SDK ClaudeCodeOptions for API consistency
 type QueryOptions struct {
 	// Core conversation control (matches Python SDK exactly)
-	MaxTurns     int    `json:"max_turns,omitempty"`
-	SystemPrompt string `json:"system_prompt,omitempty"`
-	WorkingDir   string `json:"cwd,omitempty"`
+	MaxTurns           int    `json:"max_turns,omitempty"`
+	SystemPrompt       string `json:"system_prompt,omitempty"`
+	AppendSystemPrompt string `json:"append_system_prompt,omitempty"`
+	WorkingDir         string `json:"cwd,omitempty"`
 	
 	// Tool and permission management (matches Python SDK)
-	AllowedTools   []string `json:"allowed_tools,omitempty"`
-	PermissionMode string   `json:"permission_mode,omitempty"`
+	AllowedTools             []string       `json:"allowed_tools,omitempty"`
+	DisallowedTools          []string       `json:"disallowed_tools,omitempty"`
+	PermissionMode           PermissionMode `json:"permission_mode,omitempty"`
+	PermissionPromptToolName string         `json:"permission_prompt_tool_name,omitempty"`
+	
+	// MCP servers, either inline or as a config file path (Python accepts both for mcp_servers)
+	MCPServers    map[string]MCPServerConfig `json:"mcp_servers,omitempty"`
+	MCPConfigPath string                     `json:"-"`
 	
 	// Additional Python SDK aligned options
-	Format         OutputFormat `json:"format,omitempty"`
-	Model          string       `json:"model,omitempty"`
-	ResumeID       string       `json:"resume_id,omitempty"`
-	Continue       bool         `json:"continue,omitempty"`
+	Format            OutputFormat       `json:"format,omitempty"`
+	Model             string             `json:"model,omitempty"`
+	ResumeID          string             `json:"resume,omitempty"`
+	Continue          bool               `json:"continue_conversation,omitempty"`
+	AddDirs           []string           `json:"add_dirs,omitempty"`
+	Settings          string             `json:"settings,omitempty"`
+	ExtraArgs         map[string]*string `json:"extra_args,omitempty"`
+	MaxThinkingTokens int                `json:"max_thinking_tokens,omitempty"`
+	Env               map[string]string  `json:"env,omitempty"`
 	
 	// Go-specific extensions (not serialized to maintain Python SDK alignment)
 	Context      context.Context `json:"-"`
 	BufferConfig *buffer.Config  `json:"-"`
+	CacheMode    CacheMode       `json:"-"`
+	CacheFiles   []string        `json:"-"`
+	RetryPolicy  *RetryPolicy    `json:"-"`
+}
+
+// MarshalJSON encodes QueryOptions using Python SDK field names
+// When only MCPConfigPath is set, mcp_servers is written as a path string like in Python
+func (o QueryOptions) MarshalJSON() ([]byte, error) {
+	type plain QueryOptions
+	aux := struct {
+		plain
+		MCPServers interface{} `json:"mcp_servers,omitempty"`
+	}{plain: plain(o)}
+	
+	if len(o.MCPServers) > 0 {
+		aux.MCPServers = o.MCPServers
+	} else if o.MCPConfigPath != "" {
+		aux.MCPServers = o.MCPConfigPath
+	}
+	
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON decodes a Python SDK style options document
+// It also accepts the legacy "resume_id" and "continue" keys used by earlier versions of this SDK
+func (o *QueryOptions) UnmarshalJSON(data []byte) error {
+	type plain QueryOptions
+	aux := struct {
+		*plain
+		MCPServers     json.RawMessage `json:"mcp_servers,omitempty"`
+		LegacyResumeID string          `json:"resume_id,omitempty"`
+		LegacyContinue bool            `json:"continue,omitempty"`
+	}{plain: (*plain)(o)}
+	
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	
+	if raw := strings.TrimSpace(string(aux.MCPServers)); raw != "" && raw != "null" {
+		if strings.HasPrefix(raw, `"`) {
+			if err := json.Unmarshal(aux.MCPServers, &o.MCPConfigPath); err != nil {
+				return fmt.Errorf("invalid mcp_servers path: %w", err)
+			}
+		} else if err := json.Unmarshal(aux.MCPServers, &o.MCPServers); err != nil {
+			return fmt.Errorf("invalid mcp_servers: %w", err)
+		}
+	}
+	
+	if o.ResumeID == "" {
+		o.ResumeID = aux.LegacyResumeID
+	}
+	if !o.Continue {
+		o.Continue = aux.LegacyContinue
+	}
+	
+	return nil
 }
 
 // Message represents a message from Claude Code in streaming mode
@@ -146,11 +319,33 @@ type Message struct {
 	IsError       bool     `json:"is_error,omitempty"`
 	NumTurns      int      `json:"num_turns,omitempty"`
 	Result        string   `json:"result,omitempty"`
+	Usage         *Usage   `json:"usage,omitempty"`
 	Tools         []string `json:"tools,omitempty"`
 	MCPServers    []struct {
 		Name   string `json:"name"`
 		Status string `json:"status"`
 	} `json:"mcp_servers,omitempty"`
+
+	// Body is the typed form of Message, decoded together with the stream line
+	Body *MessageBody `json:"-"`
+	// Diagnostic describes the stdout line behind a diagnostic message
+	Diagnostic *StreamLineError `json:"-"`
+}
+
+// toResult converts a result message into a ClaudeResult
+func (m Message) toResult() *ClaudeResult {
+	return &ClaudeResult{
+		Type:          m.Type,
+		Subtype:       m.Subtype,
+		Result:        m.Result,
+		CostUSD:       m.CostUSD,
+		DurationMS:    m.DurationMS,
+		DurationAPIMS: m.DurationAPIMS,
+		IsError:       m.IsError,
+		NumTurns:      m.NumTurns,
+		SessionID:     m.SessionID,
+		Usage:         m.Usage,
+	}
 }
 
 // validateMCPToolName validates that MCP tool names follow the correct pattern: mcp__<serverName>__<toolName>
@@ -209,10 +404,41 @@ func PreprocessOptions(opts *RunOptions) error {
 		}
 	}
 	
+	// Validate permission mode
+	if opts.PermissionMode != "" && !isValidPermissionMode(opts.PermissionMode) {
+		return NewValidationError("Invalid permission mode", "PermissionMode", opts.PermissionMode)
+	}
+	
+	// Validate thinking token budget
+	if opts.MaxThinkingTokens < 0 {
+		return NewValidationError("MaxThinkingTokens cannot be negative", "MaxThinkingTokens", opts.MaxThinkingTokens)
+	}
+	
 	// Validate timeout
 	if opts.Timeout < 0 {
 		return NewValidationError("Timeout cannot be negative", "Timeout", opts.Timeout)
 	}
+	if opts.StartupTimeout < 0 {
+		return NewValidationError("StartupTimeout cannot be negative", "StartupTimeout", opts.StartupTimeout)
+	}
+	if opts.IdleTimeout < 0 {
+		return NewValidationError("IdleTimeout cannot be negative", "IdleTimeout", opts.IdleTimeout)
+	}
+	
+	// Validate cache mode
+	if !isValidCacheMode(opts.CacheMode) {
+		return NewValidationError("Invalid cache mode", "CacheMode", opts.CacheMode)
+	}
+	
+	// Validate stream mode
+	if !isValidStreamMode(opts.StreamMode) {
+		return NewValidationError("Invalid stream mode", "StreamMode", opts.StreamMode)
+	}
+	
+	// Validate working directory, additional directories and environment
+	if err := validateExecEnvironment(opts); err != nil {
+		return err
+	}
 	
 	// Validate session ID format if provided
 	if opts.ResumeID != "" {
@@ -235,6 +461,16 @@ func isValidModelAlias(alias string) bool {
 	return false
 }
 
+// isValidPermissionMode checks if the permission mode is supported by the CLI
+func isValidPermissionMode(mode PermissionMode) bool {
+	switch mode {
+	case PermissionModeDefault, PermissionModeAcceptEdits, PermissionModePlan, PermissionModeBypassPermissions:
+		return true
+	default:
+		return false
+	}
+}
+
 // isValidSessionID validates session ID format (should be UUID-like)
 func isValidSessionID(sessionID string) bool {
 	// Be more lenient with session ID validation to avoid breaking existing usage
@@ -244,13 +480,17 @@ func isValidSessionID(sessionID string) bool {
 }
 
 // NewClient creates a new Claude client with the specified binary path
-func NewClient(binPath string) *ClaudeClient {
-	return &ClaudeClient{
+func NewClient(binPath string, options ...ClientOption) *ClaudeClient {
+	client := &ClaudeClient{
 		BinPath: binPath,
 		DefaultOptions: &RunOptions{
 			Format: TextOutput,
 		},
 	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
 }
 
 // RunPrompt executes a prompt with Claude Code and returns the result
@@ -260,6 +500,11 @@ func (c *ClaudeClient) RunPrompt(prompt string, opts *RunOptions) (*ClaudeResult
 
 // RunPromptCtx executes a prompt with Claude Code and returns the result with context support
 func (c *ClaudeClient) RunPromptCtx(ctx context.Context, prompt string, opts *RunOptions) (*ClaudeResult, error) {
+	return c.runPrompt(ctx, nil, prompt, opts)
+}
+
+// runPrompt is the shared implementation of RunPromptCtx and RunFromStdinCtx
+func (c *ClaudeClient) runPrompt(ctx context.Context, stdin io.Reader, prompt string, opts *RunOptions) (*ClaudeResult, error) {
 	if opts == nil {
 		opts = c.DefaultOptions
 	}
@@ -269,14 +514,66 @@ func (c *ClaudeClient) RunPromptCtx(ctx context.Context, prompt string, opts *Ru
 		return nil, err
 	}
 
-	// Add timeout support if specified
-	if opts.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
-		defer cancel()
+	ref, err := c.cacheRefFor(ctx, stdin, prompt, opts)
+	if err != nil {
+		return nil, err
 	}
+	if ref != nil && opts.CacheMode != CacheRefresh {
+		if entry, ok := c.Cache.Get(ref.key); ok {
+			return entry.cachedResult(), nil
+		}
+	}
+
+	result, stdout, err := c.execute(ctx, stdin, prompt, opts)
+	if err != nil {
+		// Error results are returned too so callers can resume the session
+		return result, err
+	}
+
+	if ref != nil {
+		entry := &CacheEntry{
+			Key:        ref.key,
+			CLIVersion: ref.version,
+			Result:     result,
+		}
+		if opts.Format == StreamJSONOutput {
+			entry.Transcript = stdout
+		}
+		// A failed cache write must not fail the run
+		if c.Cache.Put(entry) == nil {
+			result.Cache = &CacheInfo{Key: ref.key, StoredAt: entry.CreatedAt}
+		}
+	}
+
+	return result, nil
+}
 
+// execute runs the Claude process once and returns the parsed result and raw stdout
+func (c *ClaudeClient) execute(ctx context.Context, stdin io.Reader, prompt string, opts *RunOptions) (result *ClaudeResult, output []byte, err error) {
+	ctx, span := c.tracer().Start(ctx, SpanRun, runAttributes(opts)...)
+	defer func() {
+		endRunSpan(span, result, err)
+	}()
+
+	// Report every invocation, including launches rejected by the circuit breaker or rate limiter
 	args := BuildArgs(prompt, opts)
+	inv := NewInvocation(prompt, args, opts)
+	defer func() {
+		c.ReportInvocation(ctx, inv, result, err)
+	}()
+
+	if err := c.BeginLaunch(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	// Enforce the startup, idle and total timeouts from here, so time spent in the rate limiter does not count
+	ctx, watchdog := StartWatchdog(ctx, opts)
+	defer watchdog.Stop()
+
+	var launchErr error
+	defer func() {
+		c.EndLaunch(ctx, launchErr)
+	}()
 
 	// Set up buffer management
 	bufferConfig := opts.BufferConfig
@@ -285,40 +582,89 @@ func (c *ClaudeClient) RunPromptCtx(ctx context.Context, prompt string, opts *Ru
 	}
 	bufManager := buffer.NewBufferManager(bufferConfig)
 	
-	cmd := execCommand(ctx, c.BinPath, args...)
-	stdout := bufManager.NewStdoutBuffer()
-	stderr := bufManager.NewStderrBuffer()
+	cmd, err := c.newCommand(ctx, args, opts)
+	if err != nil {
+		launchErr = notStarted(err)
+		return nil, nil, err
+	}
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	stdout := c.monitorOutput(bufManager.NewStdoutOutput())
+	defer stdout.Close()
+	stderr := c.monitorOutput(bufManager.NewStderrOutput())
+	defer stderr.Close()
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	watchdog.Watch(cmd)
 
-	err := cmd.Run()
+	err = cmd.Run()
+	inv.Finish(cmd, stdout, stderr)
 	if err != nil {
 		// Enhanced error parsing
-		var exitCode int
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = 1
+		claudeErr := c.ClassifyRunError(ctx, err, stderr.String())
+		launchErr = claudeErr
+		// The CLI exits non-zero with an error result; keep it so callers can resume the session
+		if opts.Format == JSONOutput && ctx.Err() == nil {
+			if res, decodeErr := decodeResult(stdout); decodeErr == nil {
+				res.BufferStats = newBufferStats(stdout, stderr)
+				// The result describes the failure more precisely than stderr
+				if resultErr := ResultError(res); resultErr != nil {
+					resultErr.Code = claudeErr.Code
+					resultErr.Original = err
+					launchErr = resultErr
+					return res, nil, resultErr
+				}
+				return res, nil, claudeErr
+			}
 		}
-		
-		claudeErr := ParseError(stderr.String(), exitCode)
-		claudeErr.Original = err
-		return nil, claudeErr
+		return nil, nil, claudeErr
 	}
 
 	if opts.Format == JSONOutput {
-		var res ClaudeResult
-		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
-			return nil, NewClaudeError(ErrorValidation, fmt.Sprintf("failed to parse JSON response: %v", err))
+		res, err := decodeResult(stdout)
+		if err != nil {
+			return nil, nil, NewClaudeError(ErrorValidation, fmt.Sprintf("failed to parse JSON response: %v", err))
+		}
+		res.BufferStats = newBufferStats(stdout, stderr)
+		if resultErr := ResultError(res); resultErr != nil {
+			return res, nil, resultErr
 		}
-		return &res, nil
+		return res, nil, nil
 	}
 
 	// For text output, just return the raw text
 	return &ClaudeResult{
-		Result:  stdout.String(),
-		IsError: false,
-	}, nil
+		Result:      stdout.String(),
+		IsError:     false,
+		BufferStats: newBufferStats(stdout, stderr),
+	}, stdout.Bytes(), nil
+}
+
+// decodeResult parses a JSON result from captured stdout without copying spilled output into memory
+func decodeResult(stdout buffer.Output) (*ClaudeResult, error) {
+	reader, err := stdout.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var res ClaudeResult
+	if err := json.NewDecoder(reader).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// newCommand creates the Claude process with the execution environment from opts applied
+func (c *ClaudeClient) newCommand(ctx context.Context, args []string, opts *RunOptions) (*exec.Cmd, error) {
+	binPath, err := c.ResolveBinPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cmd := execCommand(ctx, binPath, args...)
+	ApplyExecEnvironment(cmd, opts)
+	return cmd, nil
 }
 
 // StreamPrompt executes a prompt with Claude Code and streams the results through a channel
@@ -343,21 +689,85 @@ func (c *ClaudeClient) StreamPrompt(ctx context.Context, prompt string, opts *Ru
 		defer close(messageCh)
 		defer close(errCh)
 
+		// Preprocess and validate options on the copy so the caller's options are untouched
+		if err := PreprocessOptions(&streamOpts); err != nil {
+			errCh <- err
+			return
+		}
+
+		// Trace and log the run with the error the stream ended with
+		var streamErr error
+		fail := func(err error) {
+			streamErr = err
+			errCh <- err
+		}
+		ctx, span := c.tracer().Start(ctx, SpanRun, runAttributes(&streamOpts)...)
+		turns := newStreamTracer(ctx, c.tracer())
+		var result *ClaudeResult
+		defer func() {
+			turnCount, toolUses := turns.finish()
+			span.SetAttributes(Attr("claude.turns", turnCount), Attr("claude.tool_uses", toolUses))
+			endRunSpan(span, result, streamErr)
+		}()
+
+		// Report every invocation, including launches rejected by the circuit breaker or rate limiter
+		inv := NewInvocation(prompt, args, &streamOpts)
+		inv.Messages = make(map[string]int)
+		var cmd *exec.Cmd
+		var stdoutBytes int64
+		var stderrBuf buffer.Output
+		defer func() {
+			inv.Finish(cmd, nil, stderrBuf)
+			inv.StdoutBytes = stdoutBytes
+			inv.Tools = turns.toolNames
+			c.ReportInvocation(ctx, inv, result, streamErr)
+		}()
+
+		if err := c.BeginLaunch(ctx); err != nil {
+			fail(err)
+			return
+		}
+
+		// Enforce the startup, idle and total timeouts from here, so time spent in the rate limiter does not count
+		ctx, watchdog := StartWatchdog(ctx, &streamOpts)
+		defer watchdog.Stop()
+
+		// Report the outcome of the launch however the stream ends
+		var launchErr error
+		defer func() {
+			c.EndLaunch(ctx, launchErr)
+		}()
+
 		// Create a custom command that supports context
-		cmd := execCommand(ctx, c.BinPath, args...)
+		cmd, err := c.newCommand(ctx, args, &streamOpts)
+		if err != nil {
+			launchErr = notStarted(err)
+			fail(err)
+			return
+		}
+		// Output is watched through the pipe readers below
+		watchdog.Watch(cmd)
 
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
-			errCh <- fmt.Errorf("failed to get stdout pipe: %w", err)
+			launchErr = notStarted(err)
+			fail(fmt.Errorf("failed to get stdout pipe: %w", err))
 			return
 		}
 
 		stderr, err := cmd.StderrPipe()
 		if err != nil {
-			errCh <- fmt.Errorf("failed to get stderr pipe: %w", err)
+			launchErr = notStarted(err)
+			fail(fmt.Errorf("failed to get stderr pipe: %w", err))
 			return
 		}
 
+		// A killed process can leave children holding stdout open; stop reading once the run is over
+		stopReading := context.AfterFunc(ctx, func() {
+			stdout.Close()
+		})
+		defer stopReading()
+
 		// Set up buffer management for streaming
 		bufferConfig := opts.BufferConfig
 		if bufferConfig == nil {
@@ -366,58 +776,69 @@ func (c *ClaudeClient) StreamPrompt(ctx context.Context, prompt string, opts *Ru
 		bufManager := buffer.NewBufferManager(bufferConfig)
 		
 		// Start capturing stderr in a goroutine with limits
-		stderrBuf := bufManager.NewStderrBuffer()
+		stderrBuf = c.monitorOutput(bufManager.NewStderrOutput())
+		defer stderrBuf.Close()
+		stderrDone := make(chan struct{})
 		go func() {
-			_ = bufManager.CopyWithTimeout(ctx, stderrBuf, stderr)
+			defer close(stderrDone)
+			// The watchdog bounds the run, so stderr is copied until the process closes it
+			// Failures caused by the run's own context are not buffer problems
+			if _, err := io.Copy(watchdog.Stderr(stderrBuf), stderr); err != nil && c.BufferMonitor != nil && ctx.Err() == nil {
+				c.BufferMonitor.RecordError()
+			}
 		}()
 
 		if err := cmd.Start(); err != nil {
-			errCh <- fmt.Errorf("failed to start command: %w", err)
+			claudeErr := c.ClassifyRunError(ctx, err, "")
+			launchErr = notStarted(claudeErr)
+			fail(claudeErr)
 			return
 		}
 
-		// Use buffered reader with configurable buffer size instead of scanner
-		reader := bufio.NewReaderSize(stdout, int(bufferConfig.MaxStdoutSize/1000)) // Use reasonable buffer size
+		// abort ends a run that fails while its output is read: the process is killed and reaped
+		// before the error is reported, so the launch outcome and the invocation are complete
+		abort := func(err error) {
+			launchErr = err
+			cmd.Process.Kill()
+			select {
+			case <-stderrDone:
+			case <-ctx.Done():
+			case <-time.After(WatchdogWaitDelay):
+			}
+			cmd.Wait()
+			fail(err)
+		}
+
+		var resultErr *ClaudeError
+
+		// Decode line by line with a bounded line size
+		decoder := NewStreamDecoder(watchdog.StdoutReader(stdout), int(bufferConfig.MaxLineSize), streamOpts.StreamMode)
+		defer decoder.Close()
 		
 		for {
-			line, err := reader.ReadString('\n')
+			msg, err := decoder.Next()
+			stdoutBytes = decoder.Bytes()
 			if err != nil {
-				if err == io.EOF && line != "" {
-					// Process final line without newline
-				} else if err == io.EOF {
+				var lineErr *StreamLineError
+				if err == io.EOF || ctx.Err() != nil {
+					// Stopped runs are classified from the process's exit below
 					break
+				} else if errors.As(err, &lineErr) {
+					abort(&ClaudeError{Type: ErrorValidation, Message: lineErr.Error(), Original: lineErr})
+					return
 				} else {
-					errCh <- fmt.Errorf("failed to read line: %w", err)
+					abort(fmt.Errorf("failed to read line: %w", err))
 					return
 				}
 			}
 
-			// Skip empty lines
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-
-			var msg Message
-			if err := json.Unmarshal([]byte(line), &msg); err != nil {
-				errCh <- fmt.Errorf("failed to parse JSON message: %w", err)
-				return
-			}
+			inv.Messages[msg.Type]++
+			turns.observe(msg)
 
-			// Populate Content field for Python SDK alignment
-			if msg.Content == "" && len(msg.Message) > 0 {
-				// Try to extract content from the raw message
-				var messageContent struct {
-					Content string `json:"content"`
-					Text    string `json:"text"`
-				}
-				if err := json.Unmarshal(msg.Message, &messageContent); err == nil {
-					if messageContent.Content != "" {
-						msg.Content = messageContent.Content
-					} else if messageContent.Text != "" {
-						msg.Content = messageContent.Text
-					}
-				}
+			// Remember failed results so the stream ends with a typed error
+			if msg.Type == "result" {
+				result = msg.toResult()
+				resultErr = ResultError(result)
 			}
 
 			select {
@@ -425,27 +846,35 @@ func (c *ClaudeClient) StreamPrompt(ctx context.Context, prompt string, opts *Ru
 				// Message sent successfully
 			case <-ctx.Done():
 				// Context was canceled
-				errCh <- ctx.Err()
+				abort(c.ClassifyRunError(ctx, ctx.Err(), stderrBuf.String()))
 				return
 			}
 		}
 
 		// End of stream reached
 
+		// Drain stderr before Wait closes the pipe so errors are classified from the full output
+		select {
+		case <-stderrDone:
+		case <-ctx.Done():
+		}
+
 		if err := cmd.Wait(); err != nil {
 			// Enhanced error parsing for streaming
-			var exitCode int
-			if exitError, ok := err.(*exec.ExitError); ok {
-				exitCode = exitError.ExitCode()
-			} else {
-				exitCode = 1
+			claudeErr := c.ClassifyRunError(ctx, err, stderrBuf.String())
+			// The result message describes the failure more precisely than stderr
+			if resultErr != nil && ctx.Err() == nil {
+				resultErr.Code = claudeErr.Code
+				resultErr.Original = err
+				claudeErr = resultErr
 			}
-			
-			claudeErr := ParseError(stderrBuf.String(), exitCode)
-			claudeErr.Original = err
-			errCh <- claudeErr
+			launchErr = claudeErr
+			fail(claudeErr)
 			return
 		}
+		if resultErr != nil {
+			fail(resultErr)
+		}
 	}()
 
 	return messageCh, errCh
@@ -458,66 +887,7 @@ func (c *ClaudeClient) RunFromStdin(stdin io.Reader, prompt string, opts *RunOpt
 
 // RunFromStdinCtx runs Claude Code with input from stdin with context support
 func (c *ClaudeClient) RunFromStdinCtx(ctx context.Context, stdin io.Reader, prompt string, opts *RunOptions) (*ClaudeResult, error) {
-	if opts == nil {
-		opts = c.DefaultOptions
-	}
-
-	// Preprocess and validate options
-	if err := PreprocessOptions(opts); err != nil {
-		return nil, err
-	}
-
-	// Add timeout support if specified
-	if opts.Timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
-		defer cancel()
-	}
-
-	args := BuildArgs(prompt, opts)
-
-	// Set up buffer management
-	bufferConfig := opts.BufferConfig
-	if bufferConfig == nil {
-		bufferConfig = buffer.DefaultConfig()
-	}
-	bufManager := buffer.NewBufferManager(bufferConfig)
-
-	cmd := execCommand(ctx, c.BinPath, args...)
-	cmd.Stdin = stdin
-	stdout := bufManager.NewStdoutBuffer()
-	stderr := bufManager.NewStderrBuffer()
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-
-	err := cmd.Run()
-	if err != nil {
-		// Enhanced error parsing
-		var exitCode int
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = 1
-		}
-		
-		claudeErr := ParseError(stderr.String(), exitCode)
-		claudeErr.Original = err
-		return nil, claudeErr
-	}
-
-	if opts.Format == JSONOutput {
-		var res ClaudeResult
-		if err := json.Unmarshal(stdout.Bytes(), &res); err != nil {
-			return nil, NewClaudeError(ErrorValidation, fmt.Sprintf("failed to parse JSON response: %v", err))
-		}
-		return &res, nil
-	}
-
-	// For text output, just return the raw text
-	return &ClaudeResult{
-		Result:  stdout.String(),
-		IsError: false,
-	}, nil
+	return c.runPrompt(ctx, stdin, prompt, opts)
 }
 
 // Query is the primary method that aligns with Python SDK's query() function
@@ -536,7 +906,13 @@ func (c *ClaudeClient) Query(ctx context.Context, prompt string, opts QueryOptio
 		ctx = opts.Context
 	}
 	
-	messageCh, errCh := c.StreamPrompt(ctx, prompt, runOpts)
+	var messageCh <-chan Message
+	var errCh <-chan error
+	if opts.RetryPolicy != nil {
+		messageCh, errCh = c.StreamPromptWithRetry(ctx, prompt, runOpts, opts.RetryPolicy)
+	} else {
+		messageCh, errCh = c.StreamPrompt(ctx, prompt, runOpts)
+	}
 	
 	// Create a combined channel that includes error handling
 	combinedCh := make(chan Message)
@@ -590,39 +966,42 @@ func (c *ClaudeClient) QuerySync(ctx context.Context, prompt string, opts QueryO
 		ctx = opts.Context
 	}
 	
+	if opts.RetryPolicy != nil {
+		return c.RunPromptWithRetryCtx(ctx, prompt, runOpts, opts.RetryPolicy)
+	}
 	return c.RunPromptCtx(ctx, prompt, runOpts)
 }
 
 // queryOptionsToRunOptions converts QueryOptions to RunOptions for internal use
 func (c *ClaudeClient) queryOptionsToRunOptions(opts QueryOptions) *RunOptions {
 	runOpts := &RunOptions{
-		Format:         opts.Format,
-		SystemPrompt:   opts.SystemPrompt,
-		AllowedTools:   opts.AllowedTools,
-		Model:          opts.Model,
-		ResumeID:       opts.ResumeID,
-		Continue:       opts.Continue,
-		MaxTurns:       opts.MaxTurns,
-		BufferConfig:   opts.BufferConfig,
-	}
-	
-	// Map permission_mode to appropriate settings
-	switch opts.PermissionMode {
-	case "acceptEdits":
-		// Accept all edit operations
-		runOpts.AllowedTools = append(runOpts.AllowedTools, "Write", "Edit", "MultiEdit")
-	case "rejectAll":
-		// Disable all tools
-		runOpts.DisallowedTools = []string{"*"}
-	case "ask":
-		// Default behavior - Claude will ask for permissions
-		// No special configuration needed
-	}
-	
-	// Handle working directory
-	if opts.WorkingDir != "" {
-		// Working directory would be handled by changing process working directory
-		// This might require process management changes for full implementation
+		Format:            opts.Format,
+		SystemPrompt:      opts.SystemPrompt,
+		AppendPrompt:      opts.AppendSystemPrompt,
+		MCPConfigPath:     opts.MCPConfigPath,
+		MCPServers:        opts.MCPServers,
+		AllowedTools:      opts.AllowedTools,
+		DisallowedTools:   opts.DisallowedTools,
+		PermissionTool:    opts.PermissionPromptToolName,
+		PermissionMode:    opts.PermissionMode,
+		Model:             opts.Model,
+		ResumeID:          opts.ResumeID,
+		Continue:          opts.Continue,
+		MaxTurns:          opts.MaxTurns,
+		AddDirs:           opts.AddDirs,
+		Settings:          opts.Settings,
+		MaxThinkingTokens: opts.MaxThinkingTokens,
+		ExtraArgs:         opts.ExtraArgs,
+		WorkingDir:        opts.WorkingDir,
+		Env:               opts.Env,
+		BufferConfig:      opts.BufferConfig,
+		CacheMode:         opts.CacheMode,
+		CacheFiles:        opts.CacheFiles,
+	}
+	
+	// "ask" was accepted by earlier versions of this SDK and means the CLI default
+	if runOpts.PermissionMode == "ask" {
+		runOpts.PermissionMode = PermissionModeDefault
 	}
 	
 	return runOpts
@@ -654,6 +1033,13 @@ func BuildArgs(prompt string, opts *RunOptions) []string {
 		args = append(args, "--mcp-config", opts.MCPConfigPath)
 	}
 
+	// Inline MCP servers are passed as a JSON config, the same way the Python SDK does
+	if len(opts.MCPServers) > 0 {
+		if data, err := json.Marshal(map[string]interface{}{"mcpServers": opts.MCPServers}); err == nil {
+			args = append(args, "--mcp-config", string(data))
+		}
+	}
+
 	if len(opts.AllowedTools) > 0 {
 		args = append(args, "--allowedTools", strings.Join(opts.AllowedTools, ","))
 	}
@@ -666,6 +1052,10 @@ func BuildArgs(prompt string, opts *RunOptions) []string {
 		args = append(args, "--permission-prompt-tool", opts.PermissionTool)
 	}
 
+	if opts.PermissionMode != "" {
+		args = append(args, "--permission-mode", string(opts.PermissionMode))
+	}
+
 	if opts.ResumeID != "" {
 		args = append(args, "--resume", opts.ResumeID)
 	} else if opts.Continue {
@@ -712,6 +1102,33 @@ func BuildArgs(prompt string, opts *RunOptions) []string {
 		args = append(args, "--theme", opts.Theme)
 	}
 
+	for _, dir := range opts.AddDirs {
+		args = append(args, "--add-dir", dir)
+	}
+
+	if opts.Settings != "" {
+		args = append(args, "--settings", opts.Settings)
+	}
+
+	if opts.MaxThinkingTokens > 0 {
+		args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", opts.MaxThinkingTokens))
+	}
+
+	// Extra args go last in sorted order so the command line is deterministic
+	if len(opts.ExtraArgs) > 0 {
+		flags := make([]string, 0, len(opts.ExtraArgs))
+		for flag := range opts.ExtraArgs {
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+		for _, flag := range flags {
+			args = append(args, "--"+flag)
+			if value := opts.ExtraArgs[flag]; value != nil {
+				args = append(args, *value)
+			}
+		}
+	}
+
 	return args
 }
 
@@ -773,100 +1190,6 @@ func (c *ClaudeClient) ResumeConversationCtx(ctx context.Context, prompt string,
 	})
 }
 
-// RetryPolicy defines the retry behavior for failed requests
-type RetryPolicy struct {
-	MaxRetries    int           // Maximum number of retry attempts
-	BaseDelay     time.Duration // Base delay between retries
-	MaxDelay      time.Duration // Maximum delay between retries  
-	BackoffFactor float64       // Exponential backoff factor
-}
-
-// DefaultRetryPolicy returns a sensible default retry policy
-func DefaultRetryPolicy() *RetryPolicy {
-	return &RetryPolicy{
-		MaxRetries:    3,
-		BaseDelay:     100 * time.Millisecond,
-		MaxDelay:      5 * time.Second,
-		BackoffFactor: 2.0,
-	}
-}
-
-// calculateBackoff calculates the delay for a given retry attempt
-func (rp *RetryPolicy) calculateBackoff(attempt int) time.Duration {
-	if attempt == 0 {
-		return 0
-	}
-	
-	delay := float64(rp.BaseDelay) * math.Pow(rp.BackoffFactor, float64(attempt-1))
-	
-	result := time.Duration(delay)
-	if result > rp.MaxDelay {
-		result = rp.MaxDelay
-	}
-	
-	return result
-}
-
-// RunPromptWithRetry executes a prompt with intelligent retry logic for recoverable errors
-func (c *ClaudeClient) RunPromptWithRetry(prompt string, opts *RunOptions, retryPolicy *RetryPolicy) (*ClaudeResult, error) {
-	return c.RunPromptWithRetryCtx(context.Background(), prompt, opts, retryPolicy)
-}
-
-// RunPromptWithRetryCtx executes a prompt with context support and intelligent retry logic
-func (c *ClaudeClient) RunPromptWithRetryCtx(ctx context.Context, prompt string, opts *RunOptions, retryPolicy *RetryPolicy) (*ClaudeResult, error) {
-	if retryPolicy == nil {
-		retryPolicy = DefaultRetryPolicy()
-	}
-	
-	var lastErr error
-	
-	for attempt := 0; attempt <= retryPolicy.MaxRetries; attempt++ {
-		// Calculate delay for this attempt (0 for first attempt)
-		if attempt > 0 {
-			delay := retryPolicy.calculateBackoff(attempt)
-			
-			select {
-			case <-time.After(delay):
-				// Continue with retry
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			}
-		}
-		
-		result, err := c.RunPromptCtx(ctx, prompt, opts)
-		if err == nil {
-			return result, nil
-		}
-		
-		lastErr = err
-		
-		// Check if error is retryable
-		if claudeErr, ok := err.(*ClaudeError); ok {
-			if !claudeErr.IsRetryable() {
-				return nil, err // Don't retry non-retryable errors
-			}
-			
-			// For rate limit errors, respect the retry-after delay
-			if claudeErr.Type == ErrorRateLimit {
-				if retryAfter := claudeErr.RetryDelay(); retryAfter > 0 {
-					select {
-					case <-time.After(time.Duration(retryAfter) * time.Second):
-						continue
-					case <-ctx.Done():
-						return nil, ctx.Err()
-					}
-				}
-			}
-		} else {
-			// Non-ClaudeError types are not retryable
-			return nil, err
-		}
-	}
-	
-	// All retries exhausted
-	return nil, fmt.Errorf("max retries (%d) exceeded, last error: %w", retryPolicy.MaxRetries, lastErr)
-}
-
 // RunPromptEnhanced executes a prompt with all enhanced features: validation, timeout, and retry logic
 func (c *ClaudeClient) RunPromptEnhanced(prompt string, opts *RunOptions) (*ClaudeResult, error) {
 	return c.RunPromptEnhancedCtx(context.Background(), prompt, opts)
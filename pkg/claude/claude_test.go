@@ -3,12 +3,16 @@ package claude
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
 )
 
 // mockExecCommandContext returns a function that creates a mock command with context
@@ -33,7 +37,25 @@ func mockExecCommandContext(t *testing.T, expectedArgs []string, output string,
 		cmd.Env = []string{
 			"GO_WANT_HELPER_PROCESS=1",
 			"GO_HELPER_OUTPUT=" + output,
-			"GO_HELPER_EXIT_CODE=" + string(rune(exitCode)+'0'),
+			"GO_HELPER_EXIT_CODE=" + strconv.Itoa(exitCode),
+		}
+		return cmd
+	}
+}
+
+// mockExecCommandStderr returns a mock command that writes stderr and exits with the given code
+// Arguments are not verified
+func mockExecCommandStderr(stdout, stderr string, exitCode int) func(context.Context, string, ...string) *exec.Cmd {
+	return func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--", name}
+		cs = append(cs, arg...)
+
+		cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+		cmd.Env = []string{
+			"GO_WANT_HELPER_PROCESS=1",
+			"GO_HELPER_OUTPUT=" + stdout,
+			"GO_HELPER_STDERR=" + stderr,
+			"GO_HELPER_EXIT_CODE=" + strconv.Itoa(exitCode),
 		}
 		return cmd
 	}
@@ -47,11 +69,14 @@ func TestHelperProcess(t *testing.T) {
 	defer os.Exit(0)
 
 	output := os.Getenv("GO_HELPER_OUTPUT")
-	exitCode := int(os.Getenv("GO_HELPER_EXIT_CODE")[0] - '0')
+	exitCode, _ := strconv.Atoi(os.Getenv("GO_HELPER_EXIT_CODE"))
 
 	if output != "" {
 		os.Stdout.Write([]byte(output))
 	}
+	if stderr := os.Getenv("GO_HELPER_STDERR"); stderr != "" {
+		os.Stderr.Write([]byte(stderr))
+	}
 
 	os.Exit(exitCode)
 }
@@ -575,6 +600,180 @@ func TestRunPromptCtx_CommandFailure(t *testing.T) {
 	}
 }
 
+func TestRunPromptCtx_ErrorResult(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	jsonOutput := `{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":3,"session_id":"partial-session"}`
+	execCommand = mockExecCommandContext(t, []string{"-p", "Long task", "--output-format", "json"}, jsonOutput, 0)
+
+	client := &ClaudeClient{BinPath: "claude"}
+	result, err := client.RunPromptCtx(context.Background(), "Long task", &RunOptions{Format: JSONOutput})
+
+	claudeErr, ok := err.(*ClaudeError)
+	if !ok || claudeErr.Type != ErrorMaxTurns {
+		t.Fatalf("Expected ErrorMaxTurns, got %v", err)
+	}
+	// The partial result is returned so the session can be resumed
+	if result == nil || result.SessionID != "partial-session" || result.NumTurns != 3 {
+		t.Errorf("Expected partial result with session ID, got %+v", result)
+	}
+}
+
+func TestRunPromptCtx_ErrorResultNonZeroExit(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	jsonOutput := `{"type":"result","subtype":"error_max_turns","is_error":true,"num_turns":3,"session_id":"partial-session"}`
+	execCommand = mockExecCommandStderr(jsonOutput, "", 1)
+
+	client := &ClaudeClient{BinPath: "claude"}
+	result, err := client.RunPromptCtx(context.Background(), "Long task", &RunOptions{Format: JSONOutput})
+
+	claudeErr, ok := err.(*ClaudeError)
+	if !ok || claudeErr.Type != ErrorMaxTurns || claudeErr.Code != 1 {
+		t.Fatalf("Expected ErrorMaxTurns with exit code 1, got %v", err)
+	}
+	if result == nil || result.SessionID != "partial-session" {
+		t.Errorf("Expected partial result with session ID, got %+v", result)
+	}
+}
+
+func TestRunPromptCtx_MultiDigitExitCode(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecCommandStderr("", "Error: something went wrong", 42)
+
+	client := &ClaudeClient{BinPath: "claude"}
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput})
+
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Code != 42 {
+		t.Errorf("Expected exit code 42, got %v", err)
+	}
+}
+
+func TestStreamPrompt_ErrorResult(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	output := `{"type":"system","subtype":"init","session_id":"s1"}
+{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}
+`
+	execCommand = mockExecCommandStderr(output, "", 0)
+
+	client := &ClaudeClient{BinPath: "claude"}
+	messageCh, errCh := client.StreamPrompt(context.Background(), "test", &RunOptions{})
+
+	var messages []Message
+	for msg := range messageCh {
+		messages = append(messages, msg)
+	}
+	err := <-errCh
+
+	if len(messages) != 2 || messages[1].Type != "result" {
+		t.Errorf("Expected the result message to be delivered, got %+v", messages)
+	}
+	claudeErr, ok := err.(*ClaudeError)
+	if !ok || claudeErr.Type != ErrorExecution || claudeErr.Details["session_id"] != "s1" {
+		t.Errorf("Expected ErrorExecution for session s1, got %v", err)
+	}
+}
+
+func TestRunPromptCtx_TimeoutAndMissingCLI(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	// A process killed by RunOptions.Timeout leaves no stderr to classify
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sleep", "5")
+	}
+	client := &ClaudeClient{BinPath: "claude"}
+	_, err := client.RunPromptCtx(context.Background(), "slow", &RunOptions{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = client.RunPromptCtx(ctx, "slow", &RunOptions{})
+	if !errors.Is(err, ErrCanceled) {
+		t.Errorf("Expected canceled error, got %v", err)
+	}
+
+	execCommand = originalExecCommand
+	client = &ClaudeClient{BinPath: "claude-sdk-test-missing-binary"}
+	_, err = client.RunPromptCtx(context.Background(), "test", &RunOptions{})
+	if !errors.Is(err, ErrCLINotFound) {
+		t.Errorf("Expected CLI not found error, got %v", err)
+	}
+}
+
+func TestRunPromptCtx_SpilledOutput(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	large := strings.Repeat("x", 4096)
+	execCommand = mockExecCommandStderr(`{"type":"result","result":"`+large+`","session_id":"abc"}`, "", 0)
+
+	spillDir := t.TempDir()
+	bufferConfig := buffer.DefaultConfig()
+	bufferConfig.MaxStdoutSize = 256
+	bufferConfig.StdoutMode = buffer.ModeSpill
+	bufferConfig.SpillDir = spillDir
+
+	client := NewClient("claude")
+	result, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput, BufferConfig: bufferConfig})
+	if err != nil {
+		t.Fatalf("Expected spilled JSON to parse, got %v", err)
+	}
+	if result.Result != large {
+		t.Errorf("Expected the full result, got %d bytes", len(result.Result))
+	}
+	if files, _ := filepath.Glob(filepath.Join(spillDir, "*")); len(files) != 0 {
+		t.Errorf("Expected spill files to be cleaned up, got %v", files)
+	}
+
+	// The same output is cut off in the default truncate mode
+	bufferConfig.StdoutMode = buffer.ModeTruncate
+	if _, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput, BufferConfig: bufferConfig}); err == nil {
+		t.Error("Expected truncated JSON to fail to parse")
+	}
+}
+
+func TestRunPromptCtx_StderrTail(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	// The final error line survives stderr noise beyond MaxStderrSize
+	noise := strings.Repeat("debug: loading plugin\n", 200)
+	execCommand = mockExecCommandStderr("", noise+"Error: Rate limit exceeded", 1)
+
+	bufferConfig := buffer.DefaultConfig()
+	bufferConfig.MaxStderrSize = 128
+	bufferConfig.RingHeadSize = 0
+
+	client := NewClient("claude")
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput, BufferConfig: bufferConfig})
+	if !errors.Is(err, ErrRateLimit) {
+		t.Errorf("Expected rate limit error from the stderr tail, got %v", err)
+	}
+}
+
 func TestRunFromStdinCtx_JSONParsingError(t *testing.T) {
 	originalExecCommand := execCommand
 	defer func() {
@@ -31,7 +31,7 @@ type SecurityGate struct {
 
 // NewDangerousClient creates a client with dangerous capabilities
 // Returns error unless security requirements are met
-func NewDangerousClient(binPath string) (*DangerousClient, error) {
+func NewDangerousClient(binPath string, options ...claude.ClientOption) (*DangerousClient, error) {
 	gate := &SecurityGate{}
 
 	// Check environment variable confirmation
@@ -53,7 +53,7 @@ func NewDangerousClient(binPath string) (*DangerousClient, error) {
 	gate.productionCheck = true
 
 	return &DangerousClient{
-		ClaudeClient: claude.NewClient(binPath),
+		ClaudeClient: claude.NewClient(binPath, options...),
 		securityGate: gate,
 		envVars:      make(map[string]string),
 		mcpDebug:     false,
@@ -174,8 +174,9 @@ func (c *DangerousClient) runWithDangerousFlags(ctx context.Context, prompt stri
 	}
 
 	// Validate and preprocess options using enhanced features
+	// Errors are returned as *claude.ClaudeError so callers can type-assert like with ClaudeClient
 	if err := claude.PreprocessOptions(opts); err != nil {
-		return nil, fmt.Errorf("dangerous options validation failed: %w", err)
+		return nil, markDangerous(err)
 	}
 
 	// Build arguments using the main package's enhanced BuildArgs
@@ -193,13 +194,33 @@ func (c *DangerousClient) runWithDangerousFlags(ctx context.Context, prompt stri
 		}
 	}
 
-	// Create command with context support
-	cmd := exec.CommandContext(ctx, c.ClaudeClient.BinPath, args...)
+	// Resolve the binary, honoring any version pin on the client
+	binPath, err := c.ClaudeClient.ResolveBinPath(ctx)
+	if err != nil {
+		return nil, markDangerous(err)
+	}
+
+	// Report every invocation, including launches rejected by the circuit breaker or rate limiter
+	inv := claude.NewInvocation(prompt, args, opts)
+	if err := c.ClaudeClient.BeginLaunch(ctx); err != nil {
+		c.ClaudeClient.ReportInvocation(ctx, inv, nil, err)
+		return nil, err
+	}
+
+	// Enforce the startup, idle and total timeouts from here, so time spent in the rate limiter does not count
+	ctx, watchdog := claude.StartWatchdog(ctx, opts)
+	defer watchdog.Stop()
+
+	// Create command with context support and the run's execution environment
+	cmd := exec.CommandContext(ctx, binPath, args...)
+	claude.ApplyExecEnvironment(cmd, opts)
 
 	// Set custom environment if requested
 	if useCustomEnv && len(c.envVars) > 0 {
-		// Start with current environment
-		cmd.Env = os.Environ()
+		// Start with the environment prepared from the run options
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
 		// Add custom variables
 		for key, value := range c.envVars {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
@@ -218,34 +239,56 @@ func (c *DangerousClient) runWithDangerousFlags(ctx context.Context, prompt stri
 	bufManager := buffer.NewBufferManager(bufferConfig)
 	
 	// Execute command with enhanced error handling
-	stdout := bufManager.NewStdoutBuffer()
-	stderr := bufManager.NewStderrBuffer()
+	stdout := bufManager.NewStdoutOutput()
+	defer stdout.Close()
+	stderr := bufManager.NewStderrOutput()
+	defer stderr.Close()
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	watchdog.Watch(cmd)
 
-	err := cmd.Run()
+	err = cmd.Run()
+	inv.Finish(cmd, stdout, stderr)
 	if err != nil {
 		// Use enhanced error parsing from main package
-		var exitCode int
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
-		} else {
-			exitCode = 1
+		claudeErr := c.ClaudeClient.ClassifyRunError(ctx, err, stderr.String())
+		// The CLI exits non-zero with an error result; keep it so callers can resume the session
+		if opts.Format == claude.JSONOutput && ctx.Err() == nil {
+			var result claude.ClaudeResult
+			if json.Unmarshal(stdout.Bytes(), &result) == nil {
+				// The result describes the failure more precisely than stderr
+				if resultErr := claude.ResultError(&result); resultErr != nil {
+					resultErr.Code = claudeErr.Code
+					resultErr.Original = err
+					claudeErr = resultErr
+				}
+				c.ClaudeClient.EndLaunch(ctx, claudeErr)
+				c.ClaudeClient.ReportInvocation(ctx, inv, &result, claudeErr)
+				return &result, markDangerous(claudeErr)
+			}
 		}
-		
-		claudeErr := claude.ParseError(stderr.String(), exitCode)
-		claudeErr.Original = err
-		return nil, fmt.Errorf("dangerous claude command failed: %w", claudeErr)
+		c.ClaudeClient.EndLaunch(ctx, claudeErr)
+		c.ClaudeClient.ReportInvocation(ctx, inv, nil, claudeErr)
+		return nil, markDangerous(claudeErr)
 	}
+	c.ClaudeClient.EndLaunch(ctx, nil)
 
 	// Parse response based on format
 	if opts.Format == claude.JSONOutput {
 		var result claude.ClaudeResult
-		if err := json.Unmarshal([]byte(stdout.String()), &result); err != nil {
-			return nil, claude.NewClaudeError(claude.ErrorValidation, fmt.Sprintf("failed to parse JSON response: %v", err))
+		if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+			parseErr := claude.NewClaudeError(claude.ErrorValidation, fmt.Sprintf("failed to parse JSON response: %v", err))
+			c.ClaudeClient.ReportInvocation(ctx, inv, nil, parseErr)
+			return nil, parseErr
+		}
+		if resultErr := claude.ResultError(&result); resultErr != nil {
+			c.ClaudeClient.ReportInvocation(ctx, inv, &result, resultErr)
+			return &result, resultErr
 		}
+		c.ClaudeClient.ReportInvocation(ctx, inv, &result, nil)
 		return &result, nil
 	}
+	c.ClaudeClient.ReportInvocation(ctx, inv, nil, nil)
 
 	// For text output, return the raw text
 	return &claude.ClaudeResult{
@@ -274,3 +317,17 @@ func (c *DangerousClient) ResetDangerousSettings() {
 	c.mcpDebug = false
 	fmt.Fprintf(os.Stderr, "🔄 RESET: All dangerous settings cleared\n")
 }
+
+// markDangerous records in a ClaudeError's details that it came from a dangerous operation
+// Errors of other types are returned unchanged
+func markDangerous(err error) error {
+	claudeErr, ok := err.(*claude.ClaudeError)
+	if !ok {
+		return err
+	}
+	if claudeErr.Details == nil {
+		claudeErr.Details = make(map[string]interface{})
+	}
+	claudeErr.Details["dangerous"] = true
+	return claudeErr
+}
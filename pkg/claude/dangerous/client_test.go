@@ -1,7 +1,9 @@
 package dangerous
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/marvai-dev/claude-code-go/pkg/claude"
@@ -180,6 +182,61 @@ func TestSecurityGate_UnconfirmedGateBlocks(t *testing.T) {
 	}
 }
 
+func TestDangerousClient_ErrorsAreClaudeErrors(t *testing.T) {
+	t.Setenv("CLAUDE_ENABLE_DANGEROUS", "i-accept-all-risks")
+
+	// A fake CLI that reports a rate limit
+	binPath := filepath.Join(t.TempDir(), "claude")
+	script := "#!/bin/sh\necho 'rate limit exceeded, retry after 30 seconds' >&2\nexit 1\n"
+	if err := os.WriteFile(binPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewDangerousClient(binPath)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	_, err = client.BYPASS_ALL_PERMISSIONS("test", nil)
+	claudeErr, ok := err.(*claude.ClaudeError)
+	if !ok {
+		t.Fatalf("Expected *claude.ClaudeError, got %T: %v", err, err)
+	}
+	if !errors.Is(err, claude.ErrRateLimit) || claudeErr.Details["dangerous"] != true {
+		t.Errorf("Expected dangerous rate limit error, got %v (details %v)", err, claudeErr.Details)
+	}
+
+	_, err = client.BYPASS_ALL_PERMISSIONS("test", &claude.RunOptions{PermissionMode: "invalid"})
+	if _, ok := err.(*claude.ClaudeError); !ok || !errors.Is(err, claude.ErrValidation) {
+		t.Errorf("Expected validation ClaudeError, got %T: %v", err, err)
+	}
+}
+
+func TestDangerousClient_ErrorResultNonZeroExit(t *testing.T) {
+	t.Setenv("CLAUDE_ENABLE_DANGEROUS", "i-accept-all-risks")
+
+	// A fake CLI that stops at the turn limit and exits non-zero
+	binPath := filepath.Join(t.TempDir(), "claude")
+	script := "#!/bin/sh\necho '{\"type\":\"result\",\"subtype\":\"error_max_turns\",\"is_error\":true,\"num_turns\":3,\"session_id\":\"partial-session\"}'\nexit 1\n"
+	if err := os.WriteFile(binPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewDangerousClient(binPath)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	result, err := client.BYPASS_ALL_PERMISSIONS("test", &claude.RunOptions{Format: claude.JSONOutput})
+	claudeErr, ok := err.(*claude.ClaudeError)
+	if !ok || claudeErr.Type != claude.ErrorMaxTurns || claudeErr.Code != 1 || claudeErr.Details["dangerous"] != true {
+		t.Fatalf("Expected dangerous ErrorMaxTurns with exit code 1, got %v", err)
+	}
+	if result == nil || result.SessionID != "partial-session" {
+		t.Errorf("Expected partial result with session ID, got %+v", result)
+	}
+}
+
 // Helper function to check if string contains substring
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && 
@@ -51,6 +51,14 @@ func TestPreprocessOptions(t *testing.T) {
 			expectError: true,
 			errorType:   ErrorValidation,
 		},
+		{
+			name: "Negative idle timeout",
+			opts: &RunOptions{
+				IdleTimeout: -time.Second,
+			},
+			expectError: true,
+			errorType:   ErrorValidation,
+		},
 		{
 			name:        "Nil options",
 			opts:        nil,
@@ -0,0 +1,152 @@
+package claude
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvMode controls which variables of the parent environment the Claude process inherits
+type EnvMode string
+
+const (
+	// EnvModeInherit passes the full parent environment (default)
+	EnvModeInherit EnvMode = "inherit"
+	// EnvModeClean starts from an empty environment; only RunOptions.Env is set
+	// Note that the CLI usually needs at least PATH and HOME to start
+	EnvModeClean EnvMode = "clean"
+	// EnvModeAllowlist passes only the parent variables named in RunOptions.EnvAllowlist
+	EnvModeAllowlist EnvMode = "allowlist"
+)
+
+// isValidEnvMode checks if the environment mode is supported
+func isValidEnvMode(mode EnvMode) bool {
+	switch mode {
+	case "", EnvModeInherit, EnvModeClean, EnvModeAllowlist:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateExecEnvironment checks the working directory and additional directories exist
+func validateExecEnvironment(opts *RunOptions) error {
+	if !isValidEnvMode(opts.EnvMode) {
+		return NewValidationError("Invalid environment mode", "EnvMode", opts.EnvMode)
+	}
+
+	for key := range opts.Env {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return NewValidationError("Invalid environment variable name", "Env", key)
+		}
+	}
+
+	if opts.WorkingDir != "" {
+		if !isDir(opts.WorkingDir) {
+			return NewValidationError("Working directory does not exist or is not a directory", "WorkingDir", opts.WorkingDir)
+		}
+	}
+
+	for _, dir := range opts.AddDirs {
+		// Relative directories are resolved by the CLI against its working directory
+		path := dir
+		if !filepath.IsAbs(path) && opts.WorkingDir != "" {
+			path = filepath.Join(opts.WorkingDir, path)
+		}
+		if !isDir(path) {
+			return NewValidationError("Additional directory does not exist or is not a directory", "AddDirs", dir)
+		}
+	}
+
+	return nil
+}
+
+// isDir returns true if path exists and is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ApplyExecEnvironment configures the working directory and environment of cmd from opts
+// The parent environment is cmd.Env when already set, otherwise the current process environment
+// This is exported for use by the dangerous package
+func ApplyExecEnvironment(cmd *exec.Cmd, opts *RunOptions) {
+	if opts == nil {
+		return
+	}
+
+	if opts.WorkingDir != "" {
+		cmd.Dir = opts.WorkingDir
+	}
+
+	mode := opts.EnvMode
+	if mode == "" {
+		mode = EnvModeInherit
+	}
+
+	// Leave the environment untouched when there is nothing to change
+	if mode == EnvModeInherit && len(opts.Env) == 0 {
+		return
+	}
+
+	parent := cmd.Env
+	if parent == nil {
+		parent = os.Environ()
+	}
+
+	var env []string
+	switch mode {
+	case EnvModeClean:
+		env = []string{}
+	case EnvModeAllowlist:
+		// Never nil: a nil cmd.Env would make the child inherit the whole parent environment
+		env = []string{}
+		allowed := make(map[string]bool, len(opts.EnvAllowlist))
+		for _, name := range opts.EnvAllowlist {
+			allowed[name] = true
+		}
+		for _, kv := range parent {
+			if name, _, ok := strings.Cut(kv, "="); ok && allowed[name] {
+				env = append(env, kv)
+			}
+		}
+	default:
+		env = append([]string{}, parent...)
+	}
+
+	cmd.Env = mergeEnv(env, opts.Env)
+}
+
+// mergeEnv sets the given variables on top of env, replacing existing entries
+// The result is never nil, so assigning it to cmd.Env never falls back to the parent environment
+func mergeEnv(env []string, vars map[string]string) []string {
+	if len(vars) == 0 {
+		if env == nil {
+			return []string{}
+		}
+		return env
+	}
+
+	result := make([]string, 0, len(env)+len(vars))
+	for _, kv := range env {
+		if name, _, ok := strings.Cut(kv, "="); ok {
+			if _, override := vars[name]; override {
+				continue
+			}
+		}
+		result = append(result, kv)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result = append(result, key+"="+vars[key])
+	}
+
+	return result
+}
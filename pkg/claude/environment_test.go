@@ -0,0 +1,164 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyExecEnvironment(t *testing.T) {
+	parent := []string{"PATH=/usr/bin", "HOME=/home/test", "SECRET=hidden"}
+
+	tests := []struct {
+		name     string
+		opts     *RunOptions
+		expected []string
+	}{
+		{
+			name:     "Inherit without overrides leaves env untouched",
+			opts:     &RunOptions{},
+			expected: parent,
+		},
+		{
+			name:     "Inherit with overrides",
+			opts:     &RunOptions{Env: map[string]string{"HOME": "/tmp", "EXTRA": "1"}},
+			expected: []string{"PATH=/usr/bin", "SECRET=hidden", "EXTRA=1", "HOME=/tmp"},
+		},
+		{
+			name:     "Clean environment",
+			opts:     &RunOptions{EnvMode: EnvModeClean, Env: map[string]string{"ONLY": "this"}},
+			expected: []string{"ONLY=this"},
+		},
+		{
+			name: "Allowlist environment",
+			opts: &RunOptions{
+				EnvMode:      EnvModeAllowlist,
+				EnvAllowlist: []string{"PATH", "HOME"},
+				Env:          map[string]string{"EXTRA": "1"},
+			},
+			expected: []string{"PATH=/usr/bin", "HOME=/home/test", "EXTRA=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("claude")
+			cmd.Env = append([]string{}, parent...)
+
+			ApplyExecEnvironment(cmd, tt.opts)
+
+			if strings.Join(cmd.Env, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected env %v, got %v", tt.expected, cmd.Env)
+			}
+		})
+	}
+
+	// An allowlist matching nothing must yield an empty environment, not an inherited one
+	for _, allowlist := range [][]string{{"NOPE_NOT_SET"}, nil} {
+		cmd := exec.Command("claude")
+		cmd.Env = append([]string{}, parent...)
+		ApplyExecEnvironment(cmd, &RunOptions{EnvMode: EnvModeAllowlist, EnvAllowlist: allowlist})
+		if cmd.Env == nil || len(cmd.Env) != 0 {
+			t.Errorf("Expected an empty non-nil env for allowlist %v, got %#v", allowlist, cmd.Env)
+		}
+	}
+
+	cmd := exec.Command("claude")
+	ApplyExecEnvironment(cmd, &RunOptions{WorkingDir: "/work"})
+	if cmd.Dir != "/work" {
+		t.Errorf("Expected Dir /work, got %q", cmd.Dir)
+	}
+	if cmd.Env != nil {
+		t.Errorf("Expected env to stay nil when nothing changes, got %v", cmd.Env)
+	}
+}
+
+func TestPreprocessOptions_ExecEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		opts        *RunOptions
+		expectField string
+	}{
+		{"Valid working dir", &RunOptions{WorkingDir: dir}, ""},
+		{"Relative add dir resolved against working dir", &RunOptions{WorkingDir: dir, AddDirs: []string{"sub"}}, ""},
+		{"Missing working dir", &RunOptions{WorkingDir: filepath.Join(dir, "missing")}, "WorkingDir"},
+		{"Working dir is a file", &RunOptions{WorkingDir: file}, "WorkingDir"},
+		{"Missing add dir", &RunOptions{AddDirs: []string{filepath.Join(dir, "missing")}}, "AddDirs"},
+		{"Invalid env mode", &RunOptions{EnvMode: "partial"}, "EnvMode"},
+		{"Invalid env name", &RunOptions{Env: map[string]string{"A=B": "x"}}, "Env"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PreprocessOptions(tt.opts)
+			if tt.expectField == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+
+			claudeErr, ok := err.(*ClaudeError)
+			if !ok {
+				t.Fatalf("Expected ClaudeError, got %T (%v)", err, err)
+			}
+			if claudeErr.Type != ErrorValidation || claudeErr.Details["field"] != tt.expectField {
+				t.Errorf("Expected validation error on %s, got %v (%v)", tt.expectField, claudeErr, claudeErr.Details)
+			}
+		})
+	}
+}
+
+func TestRunPromptCtx_ExecEnvironment(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestHelperProcessEnv", "--")
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS_ENV=1"}
+		return cmd
+	}
+
+	dir := t.TempDir()
+	client := &ClaudeClient{BinPath: "claude"}
+	result, err := client.RunPromptCtx(context.Background(), "where am I", &RunOptions{
+		WorkingDir: dir,
+		Env:        map[string]string{"CLAUDE_SDK_TEST_VAR": "from-options"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	resolved, _ := filepath.EvalSymlinks(dir)
+	expected := fmt.Sprintf("%s|from-options", resolved)
+	if result.Result != expected {
+		t.Errorf("Expected %q, got %q", expected, result.Result)
+	}
+}
+
+// TestHelperProcessEnv reports the working directory and a test variable of the mocked process
+func TestHelperProcessEnv(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS_ENV") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	wd, _ := os.Getwd()
+	wd, _ = filepath.EvalSymlinks(wd)
+	fmt.Fprintf(os.Stdout, "%s|%s", wd, os.Getenv("CLAUDE_SDK_TEST_VAR"))
+}
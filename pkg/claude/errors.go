@@ -1,7 +1,13 @@
 package claude
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"math"
+	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
@@ -31,38 +37,84 @@ const (
 	ErrorTimeout
 	// ErrorSession represents session management errors
 	ErrorSession
+	// ErrorCircuitOpen is returned without running the CLI while the client's circuit breaker is open
+	ErrorCircuitOpen
+	// ErrorMaxTurns represents a run that stopped after reaching the maximum number of turns
+	ErrorMaxTurns
+	// ErrorExecution represents an error reported by the CLI in its result (is_error or an error subtype)
+	ErrorExecution
+	// ErrorCanceled represents a run stopped because its context was canceled
+	ErrorCanceled
+	// ErrorOverloaded represents the API being temporarily overloaded (HTTP 529)
+	ErrorOverloaded
+	// ErrorContextWindow represents a prompt or conversation exceeding the model's context window
+	ErrorContextWindow
+	// ErrorCLINotFound represents a missing or non-executable Claude Code binary
+	ErrorCLINotFound
 )
 
 // String returns the string representation of the error type
 func (e ErrorType) String() string {
-	switch e {
-	case ErrorAuthentication:
-		return "authentication"
-	case ErrorRateLimit:
-		return "rate_limit"
-	case ErrorPermission:
-		return "permission"
-	case ErrorCommand:
-		return "command"
-	case ErrorNetwork:
-		return "network"
-	case ErrorMCP:
-		return "mcp"
-	case ErrorValidation:
-		return "validation"
-	case ErrorTimeout:
-		return "timeout"
-	case ErrorSession:
-		return "session"
-	default:
-		return "unknown"
+	if name, ok := errorTypeNames[e]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// errorTypeNames maps error types to their text form
+var errorTypeNames = map[ErrorType]string{
+	ErrorUnknown:        "unknown",
+	ErrorAuthentication: "authentication",
+	ErrorRateLimit:      "rate_limit",
+	ErrorPermission:     "permission",
+	ErrorCommand:        "command",
+	ErrorNetwork:        "network",
+	ErrorMCP:            "mcp",
+	ErrorValidation:     "validation",
+	ErrorTimeout:        "timeout",
+	ErrorSession:        "session",
+	ErrorCircuitOpen:    "circuit_open",
+	ErrorMaxTurns:       "max_turns",
+	ErrorExecution:      "execution",
+	ErrorCanceled:       "canceled",
+	ErrorOverloaded:     "overloaded",
+	ErrorContextWindow:  "context_window",
+	ErrorCLINotFound:    "cli_not_found",
+}
+
+// MarshalText encodes the error type as its name so JSON shows "rate_limit" instead of 2
+func (e ErrorType) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText decodes an error type from its name
+// Numeric values are accepted for compatibility with the previous integer encoding
+func (e *ErrorType) UnmarshalText(text []byte) error {
+	name := string(text)
+	for errorType, typeName := range errorTypeNames {
+		if typeName == name {
+			*e = errorType
+			return nil
+		}
 	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if _, ok := errorTypeNames[ErrorType(n)]; ok {
+			*e = ErrorType(n)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown error type %q", name)
+}
+
+// UnmarshalJSON decodes an error type from a JSON string or, for older payloads, a number
+func (e *ErrorType) UnmarshalJSON(data []byte) error {
+	return e.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
 }
 
 // IsRetryable returns true if this error type is generally retryable
 func (e ErrorType) IsRetryable() bool {
 	switch e {
-	case ErrorRateLimit, ErrorNetwork, ErrorTimeout:
+	case ErrorRateLimit, ErrorNetwork, ErrorTimeout, ErrorOverloaded:
 		return true
 	case ErrorMCP:
 		// MCP errors are sometimes retryable (connection issues) but not always (config issues)
@@ -79,6 +131,44 @@ type ClaudeError struct {
 	Code     int                    `json:"code,omitempty"`
 	Details  map[string]interface{} `json:"details,omitempty"`
 	Original error                  `json:"-"`
+
+	// sentinel marks the package-level Err* values that errors.Is matches by type
+	sentinel bool
+}
+
+// Sentinel errors for use with errors.Is, e.g. errors.Is(err, claude.ErrRateLimit)
+// They match any *ClaudeError of the same ErrorType
+var (
+	ErrAuthentication = newSentinel(ErrorAuthentication)
+	ErrRateLimit      = newSentinel(ErrorRateLimit)
+	ErrPermission     = newSentinel(ErrorPermission)
+	ErrCommand        = newSentinel(ErrorCommand)
+	ErrNetwork        = newSentinel(ErrorNetwork)
+	ErrMCP            = newSentinel(ErrorMCP)
+	ErrValidation     = newSentinel(ErrorValidation)
+	ErrTimeout        = newSentinel(ErrorTimeout)
+	ErrSession        = newSentinel(ErrorSession)
+	ErrCircuitOpen    = newSentinel(ErrorCircuitOpen)
+	ErrMaxTurns       = newSentinel(ErrorMaxTurns)
+	ErrExecution      = newSentinel(ErrorExecution)
+	ErrCanceled       = newSentinel(ErrorCanceled)
+	ErrOverloaded     = newSentinel(ErrorOverloaded)
+	ErrContextWindow  = newSentinel(ErrorContextWindow)
+	ErrCLINotFound    = newSentinel(ErrorCLINotFound)
+)
+
+// newSentinel creates the sentinel error for an error type
+func newSentinel(errorType ErrorType) *ClaudeError {
+	return &ClaudeError{Type: errorType, Message: errorType.String(), sentinel: true}
+}
+
+// Is reports whether target is the sentinel for this error's type
+func (e *ClaudeError) Is(target error) bool {
+	t, ok := target.(*ClaudeError)
+	if !ok || !t.sentinel {
+		return false
+	}
+	return t.Type == e.Type
 }
 
 // Error implements the error interface
@@ -112,7 +202,18 @@ func (e *ClaudeError) IsRetryable() bool {
 // isMCPConnectionError determines if an MCP error is due to connection issues (retryable)
 // vs configuration issues (not retryable)
 func (e *ClaudeError) isMCPConnectionError() bool {
+	// Classified errors record which rule matched; their message is the rule's fixed text
+	switch e.Details["classifier_rule"] {
+	case "mcp_connection":
+		return true
+	case "mcp_config":
+		return false
+	}
+
 	lowerMsg := strings.ToLower(e.Message)
+	if stderr, ok := e.Details["stderr"].(string); ok {
+		lowerMsg += "\n" + strings.ToLower(stderr)
+	}
 	
 	// Connection-related issues (retryable)
 	connectionKeywords := []string{
@@ -147,12 +248,15 @@ func (e *ClaudeError) RetryDelay() int {
 	switch e.Type {
 	case ErrorRateLimit:
 		// Extract retry-after header value if available
-		if retryAfter, exists := e.Details["retry_after"]; exists {
-			if seconds, ok := retryAfter.(int); ok {
-				return seconds
-			}
+		if seconds, ok := e.retryAfter(); ok {
+			return seconds
 		}
 		return 60 // Default 1 minute for rate limits
+	case ErrorOverloaded:
+		if seconds, ok := e.retryAfter(); ok {
+			return seconds
+		}
+		return 30 // Overload usually clears within seconds to a minute
 	case ErrorNetwork, ErrorTimeout:
 		return 5 // 5 seconds for network issues
 	case ErrorMCP:
@@ -165,179 +269,124 @@ func (e *ClaudeError) RetryDelay() int {
 	}
 }
 
-// ParseError analyzes stderr output and exit code to create a structured ClaudeError
-// This is exported for use by the dangerous package
-func ParseError(stderr string, exitCode int) *ClaudeError {
-	stderr = strings.TrimSpace(stderr)
-	lowerStderr := strings.ToLower(stderr)
-	
-	// Authentication errors
-	if containsAny(lowerStderr, []string{
-		"authentication", "api key", "unauthorized", "401", "forbidden", "403",
-		"invalid api key", "missing api key", "anthropic_api_key",
-	}) {
-		return &ClaudeError{
-			Type:    ErrorAuthentication,
-			Message: "Authentication failed - check ANTHROPIC_API_KEY environment variable",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": "Verify your API key is valid and has necessary permissions",
-				"stderr":     stderr,
-			},
-		}
-	}
-	
-	// Rate limit errors
-	if containsAny(lowerStderr, []string{
-		"rate limit", "too many requests", "429", "quota exceeded",
-		"request limit", "usage limit",
-	}) {
-		retryAfter := extractRetryAfter(stderr)
-		details := map[string]interface{}{
-			"suggestion": "Wait before retrying or reduce request frequency",
-			"stderr":     stderr,
-		}
-		if retryAfter > 0 {
-			details["retry_after"] = retryAfter
-		}
-		
-		return &ClaudeError{
-			Type:    ErrorRateLimit,
-			Message: "Rate limit exceeded - please wait before retrying",
-			Code:    exitCode,
-			Details: details,
-		}
-	}
-	
-	// Permission errors
-	if containsAny(lowerStderr, []string{
-		"permission denied", "not allowed", "tool not permitted",
-		"access denied", "insufficient permissions", "unauthorized tool",
-	}) {
-		return &ClaudeError{
-			Type:    ErrorPermission,
-			Message: "Tool usage not permitted - check allowed/disallowed tools configuration",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": "Update --allowedTools or permissions settings",
-				"stderr":     stderr,
-			},
-		}
-	}
-	
-	// MCP errors (check before network errors since MCP can have connection issues too)
-	if containsAny(lowerStderr, []string{
-		"mcp", "model context protocol", "mcp server", "mcp tool",
-		"mcp config", "server error", "protocol error",
-	}) {
-		errorType := ErrorMCP
-		suggestion := "Check MCP server configuration and ensure servers are running"
-		
-		// Determine if it's a connection or configuration issue
-		if containsAny(lowerStderr, []string{
-			"connection", "connect", "unreachable", "timeout", "refused",
-		}) {
-			suggestion = "MCP server connection failed - ensure server is running and accessible"
-		} else if containsAny(lowerStderr, []string{
-			"config", "configuration", "invalid", "not found", "parse",
-		}) {
-			suggestion = "MCP configuration error - check your MCP config file"
-		}
-		
-		return &ClaudeError{
-			Type:    errorType,
-			Message: "MCP server error",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": suggestion,
-				"stderr":     stderr,
-			},
+// retryAfter returns Details["retry_after"] in whole seconds
+// Errors decoded from JSON carry it as float64 or json.Number instead of int
+func (e *ClaudeError) retryAfter() (int, bool) {
+	switch v := e.Details["retry_after"].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(math.Ceil(v)), true
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return int(math.Ceil(f)), true
 		}
 	}
-	
-	// Network errors (after MCP check)
-	if containsAny(lowerStderr, []string{
-		"network", "connection", "timeout", "dns", "unreachable",
-		"connection refused", "connection reset", "socket", "no internet",
-	}) {
-		return &ClaudeError{
-			Type:    ErrorNetwork,
-			Message: "Network connectivity issue",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": "Check internet connection and try again",
-				"stderr":     stderr,
-			},
-		}
+	return 0, false
+}
+
+// ParseRunError classifies the failure of a Claude process
+// Context cancellation and deadlines take precedence over stderr, since a killed process
+// usually leaves nothing useful there; failures to start the binary become ErrorCLINotFound
+// This is exported for use by the dangerous package
+func ParseRunError(ctx context.Context, runErr error, stderr string) *ClaudeError {
+	return parseRunError(ctx, runErr, stderr, DefaultErrorClassifier)
+}
+
+// parseRunError implements ParseRunError with the given classifier for stderr
+func parseRunError(ctx context.Context, runErr error, stderr string, classifier *ErrorClassifier) *ClaudeError {
+	exitCode := 1
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		exitCode = exitErr.ExitCode()
 	}
-	
-	// Timeout errors
-	if containsAny(lowerStderr, []string{
-		"timeout", "timed out", "deadline exceeded", "context deadline",
-	}) {
+
+	// Watchdog timeouts record which limit stopped the process
+	var timeoutErr *TimeoutError
+	if ctx.Err() != nil && errors.As(context.Cause(ctx), &timeoutErr) {
 		return &ClaudeError{
 			Type:    ErrorTimeout,
-			Message: "Operation timed out",
+			Message: fmt.Sprintf("Claude process was stopped by the %s timeout after %v", timeoutErr.Kind, timeoutErr.Limit),
 			Code:    exitCode,
 			Details: map[string]interface{}{
-				"suggestion": "Increase timeout or try a simpler operation",
-				"stderr":     stderr,
+				"timeout_kind": string(timeoutErr.Kind),
+				"timeout":      timeoutErr.Limit.String(),
+				"suggestion":   timeoutSuggestion(timeoutErr.Kind),
+				"stderr":       strings.TrimSpace(stderr),
 			},
+			Original: timeoutErr,
 		}
 	}
-	
-	// Session errors
-	if containsAny(lowerStderr, []string{
-		"session", "session not found", "invalid session", "session expired",
-		"resume", "conversation not found",
-	}) {
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
 		return &ClaudeError{
-			Type:    ErrorSession,
-			Message: "Session management error",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": "Check session ID or start a new conversation",
-				"stderr":     stderr,
-			},
+			Type:     ErrorTimeout,
+			Message:  "Claude process was stopped because the deadline was exceeded",
+			Code:     exitCode,
+			Details:  map[string]interface{}{"suggestion": "Increase RunOptions.Timeout or the context deadline", "stderr": strings.TrimSpace(stderr)},
+			Original: ctx.Err(),
 		}
-	}
-	
-	// Validation errors (client-side)
-	if containsAny(lowerStderr, []string{
-		"invalid", "validation", "malformed", "bad request", "400",
-		"invalid argument", "invalid option", "invalid flag",
-	}) {
+	case context.Canceled:
 		return &ClaudeError{
-			Type:    ErrorValidation,
-			Message: "Input validation failed",
-			Code:    exitCode,
-			Details: map[string]interface{}{
-				"suggestion": "Check command arguments and options",
-				"stderr":     stderr,
-			},
+			Type:     ErrorCanceled,
+			Message:  "Claude process was stopped because the context was canceled",
+			Code:     exitCode,
+			Details:  map[string]interface{}{"stderr": strings.TrimSpace(stderr)},
+			Original: ctx.Err(),
 		}
 	}
-	
-	// Generic command error
-	message := "Command execution failed"
-	if stderr != "" {
-		// Use first line of stderr as the primary message
-		lines := strings.Split(stderr, "\n")
-		if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
-			message = strings.TrimSpace(lines[0])
-		}
+
+	if exitErr == nil && isNotFoundError(runErr) {
+		return NewCLINotFoundError(runErr)
 	}
-	
+
+	claudeErr := classifier.Classify(stderr, exitCode)
+	claudeErr.Original = runErr
+	return claudeErr
+}
+
+// timeoutSuggestion explains how to avoid a watchdog timeout of the given kind
+func timeoutSuggestion(kind TimeoutKind) string {
+	switch kind {
+	case TimeoutStartup:
+		return "Increase RunOptions.StartupTimeout; slow MCP servers delay the first output"
+	case TimeoutIdle:
+		return "Increase RunOptions.IdleTimeout or check for a blocked tool or MCP server"
+	default:
+		return "Increase RunOptions.Timeout or the context deadline"
+	}
+}
+
+// isNotFoundError reports whether err means the binary could not be found or executed
+func isNotFoundError(err error) bool {
+	var execErr *exec.Error
+	var binErr *BinaryNotFoundError
+	return errors.As(err, &execErr) || errors.As(err, &binErr) ||
+		errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+// NewCLINotFoundError wraps a failure to locate or execute the Claude Code binary
+func NewCLINotFoundError(err error) *ClaudeError {
 	return &ClaudeError{
-		Type:    ErrorCommand,
-		Message: message,
-		Code:    exitCode,
+		Type:    ErrorCLINotFound,
+		Message: fmt.Sprintf("Claude Code CLI not found: %v", err),
 		Details: map[string]interface{}{
-			"stderr": stderr,
+			"suggestion": "Install it with 'npm install -g @anthropic-ai/claude-code' or set the client's BinPath",
 		},
+		Original: err,
 	}
 }
 
+// ParseError analyzes stderr output and exit code to create a structured ClaudeError
+// It classifies with DefaultErrorClassifier; see ErrorClassifier for adding rules
+// This is exported for use by the dangerous package
+func ParseError(stderr string, exitCode int) *ClaudeError {
+	return DefaultErrorClassifier.Classify(stderr, exitCode)
+}
+
 // containsAny returns true if the haystack contains any of the needles
 func containsAny(haystack string, needles []string) bool {
 	for _, needle := range needles {
@@ -371,6 +420,51 @@ func extractRetryAfter(stderr string) int {
 	return 0
 }
 
+// Result subtypes reported by the CLI in the final result message
+const (
+	ResultSubtypeSuccess              = "success"
+	ResultSubtypeErrorMaxTurns        = "error_max_turns"
+	ResultSubtypeErrorDuringExecution = "error_during_execution"
+)
+
+// ResultError converts a result that the CLI marked as failed into a ClaudeError
+// It returns nil for successful results; the session ID is kept in Details so callers can resume
+// This is exported for use by the dangerous package
+func ResultError(result *ClaudeResult) *ClaudeError {
+	if result == nil {
+		return nil
+	}
+	isErrorSubtype := strings.HasPrefix(result.Subtype, "error")
+	if !result.IsError && !isErrorSubtype {
+		return nil
+	}
+
+	details := map[string]interface{}{
+		"subtype":    result.Subtype,
+		"session_id": result.SessionID,
+		"num_turns":  result.NumTurns,
+	}
+
+	if result.Subtype == ResultSubtypeErrorMaxTurns {
+		details["suggestion"] = "Resume the session or increase MaxTurns"
+		return &ClaudeError{
+			Type:    ErrorMaxTurns,
+			Message: fmt.Sprintf("Reached maximum number of turns (%d)", result.NumTurns),
+			Details: details,
+		}
+	}
+
+	message := "Claude reported an error during execution"
+	if result.Result != "" {
+		message = result.Result
+	}
+	return &ClaudeError{
+		Type:    ErrorExecution,
+		Message: message,
+		Details: details,
+	}
+}
+
 // NewClaudeError creates a new ClaudeError with the specified type and message
 // This is exported for use by the dangerous package
 func NewClaudeError(errorType ErrorType, message string) *ClaudeError {
@@ -1,7 +1,15 @@
 package claude
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestErrorType_String(t *testing.T) {
@@ -18,6 +26,13 @@ func TestErrorType_String(t *testing.T) {
 		{ErrorValidation, "validation"},
 		{ErrorTimeout, "timeout"},
 		{ErrorSession, "session"},
+		{ErrorCircuitOpen, "circuit_open"},
+		{ErrorMaxTurns, "max_turns"},
+		{ErrorExecution, "execution"},
+		{ErrorCanceled, "canceled"},
+		{ErrorOverloaded, "overloaded"},
+		{ErrorContextWindow, "context_window"},
+		{ErrorCLINotFound, "cli_not_found"},
 		{ErrorUnknown, "unknown"},
 	}
 
@@ -44,6 +59,13 @@ func TestErrorType_IsRetryable(t *testing.T) {
 		{ErrorValidation, false},
 		{ErrorCommand, false},
 		{ErrorSession, false},
+		{ErrorCircuitOpen, false},
+		{ErrorMaxTurns, false},
+		{ErrorExecution, false},
+		{ErrorCanceled, false},
+		{ErrorOverloaded, true},
+		{ErrorContextWindow, false},
+		{ErrorCLINotFound, false},
 		{ErrorUnknown, false},
 	}
 
@@ -156,6 +178,14 @@ func TestClaudeError_RetryDelay(t *testing.T) {
 			},
 			want: 120,
 		},
+		{
+			name: "Overloaded without retry-after",
+			err: &ClaudeError{
+				Type:    ErrorOverloaded,
+				Message: "API is overloaded",
+			},
+			want: 30,
+		},
 		{
 			name: "Rate limit without retry-after",
 			err: &ClaudeError{
@@ -229,6 +259,20 @@ func TestParseError(t *testing.T) {
 			wantType: ErrorRateLimit,
 			wantMsg:  "Rate limit exceeded - please wait before retrying",
 		},
+		{
+			name:     "Overloaded error",
+			stderr:   `API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			exitCode: 1,
+			wantType: ErrorOverloaded,
+			wantMsg:  "API is overloaded - please retry shortly",
+		},
+		{
+			name:     "Context window error",
+			stderr:   "API Error: prompt is too long: 215000 tokens > 200000 maximum",
+			exitCode: 1,
+			wantType: ErrorContextWindow,
+			wantMsg:  "Prompt exceeds the model's context window",
+		},
 		{
 			name:     "Permission error",
 			stderr:   "Error: Tool 'Bash' not allowed by current permissions",
@@ -501,4 +545,147 @@ func TestContainsAny(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestResultError(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   *ClaudeResult
+		wantType ErrorType
+		wantNil  bool
+	}{
+		{
+			name:    "Success",
+			result:  &ClaudeResult{Subtype: ResultSubtypeSuccess, Result: "done"},
+			wantNil: true,
+		},
+		{
+			name:     "Max turns",
+			result:   &ClaudeResult{Subtype: ResultSubtypeErrorMaxTurns, IsError: true, NumTurns: 5, SessionID: "s1"},
+			wantType: ErrorMaxTurns,
+		},
+		{
+			name:     "Error during execution",
+			result:   &ClaudeResult{Subtype: ResultSubtypeErrorDuringExecution, SessionID: "s1"},
+			wantType: ErrorExecution,
+		},
+		{
+			name:     "is_error with success subtype",
+			result:   &ClaudeResult{Subtype: ResultSubtypeSuccess, IsError: true, Result: "API Error: 500", SessionID: "s1"},
+			wantType: ErrorExecution,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ResultError(tt.result)
+			if tt.wantNil {
+				if err != nil {
+					t.Errorf("Expected nil error, got %v", err)
+				}
+				return
+			}
+			if err == nil || err.Type != tt.wantType {
+				t.Fatalf("Expected %v error, got %v", tt.wantType, err)
+			}
+			if err.Details["session_id"] != "s1" {
+				t.Errorf("Expected session ID in details, got %v", err.Details)
+			}
+			if err.IsRetryable() {
+				t.Error("Expected result errors not to be retryable")
+			}
+		})
+	}
+}
+
+func TestClaudeError_Is(t *testing.T) {
+	rateLimit := &ClaudeError{Type: ErrorRateLimit, Message: "slow down"}
+	wrapped := fmt.Errorf("run failed: %w", rateLimit)
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"Matching sentinel", rateLimit, ErrRateLimit, true},
+		{"Wrapped error", wrapped, ErrRateLimit, true},
+		{"Different type", rateLimit, ErrAuthentication, false},
+		{"Non-sentinel target", rateLimit, &ClaudeError{Type: ErrorRateLimit}, false},
+		{"Result error", ResultError(&ClaudeResult{Subtype: ResultSubtypeErrorMaxTurns}), ErrMaxTurns, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorType_TextMarshaling(t *testing.T) {
+	data, err := json.Marshal(&ClaudeError{Type: ErrorRateLimit, Message: "slow down", Code: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"type":"rate_limit"`) {
+		t.Errorf("Expected type name in JSON, got %s", data)
+	}
+
+	var decoded ClaudeError
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != ErrorRateLimit || decoded.Message != "slow down" {
+		t.Errorf("Unexpected round trip: %+v", decoded)
+	}
+
+	// The previous integer encoding is still accepted
+	if err := json.Unmarshal([]byte(`{"type":5,"message":"old"}`), &decoded); err != nil || decoded.Type != ErrorNetwork {
+		t.Errorf("Expected numeric type to decode, got %v, %v", decoded.Type, err)
+	}
+
+	var errorType ErrorType
+	if err := errorType.UnmarshalText([]byte("bogus")); err == nil {
+		t.Error("Expected error for unknown type name")
+	}
+}
+
+func TestParseRunError(t *testing.T) {
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, lookErr := exec.LookPath("claude-sdk-test-missing-binary")
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		stderr   string
+		wantType ErrorType
+		wantIs   error
+	}{
+		{"Deadline exceeded", expired, exitErr, "", ErrorTimeout, context.DeadlineExceeded},
+		{"Canceled", canceled, exitErr, "network error", ErrorCanceled, context.Canceled},
+		{"Binary not found", context.Background(), lookErr, "", ErrorCLINotFound, exec.ErrNotFound},
+		{"Missing path", context.Background(), &fs.PathError{Op: "fork/exec", Path: "/missing/claude", Err: fs.ErrNotExist}, "", ErrorCLINotFound, fs.ErrNotExist},
+		{"Exit error uses stderr", context.Background(), exitErr, "network error: connection reset", ErrorNetwork, ErrNetwork},
+		{"Exit error without stderr", context.Background(), exitErr, "", ErrorCommand, ErrCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ParseRunError(tt.ctx, tt.err, tt.stderr)
+			if err.Type != tt.wantType {
+				t.Errorf("ParseRunError() type = %v, want %v", err.Type, tt.wantType)
+			}
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("Expected errors.Is(%v, %v)", err, tt.wantIs)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package claude
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MatchOptions controls how permission patterns are matched against paths
+type MatchOptions struct {
+	// BaseDir is the directory relative patterns and paths are resolved against, usually RunOptions.WorkingDir
+	// When empty, relative patterns only match relative paths
+	BaseDir string
+	// FollowSymlinks resolves symlinks in the path and BaseDir before matching,
+	// so a link inside BaseDir pointing elsewhere is matched by its target
+	FollowSymlinks bool
+}
+
+// MatchGlob reports whether name matches a slash-separated glob pattern
+//
+// Supported syntax:
+//   - "*" matches any sequence of characters within a path segment
+//   - "?" matches one character and "[a-z]" a character class, as in path.Match
+//   - "**" as a whole segment matches zero or more segments
+//   - "{a,b}" matches either alternative; groups may be nested
+func MatchGlob(pattern, name string) bool {
+	nameSegs := strings.Split(name, "/")
+	for _, expanded := range ExpandBraces(pattern) {
+		if matchSegments(strings.Split(expanded, "/"), nameSegs) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where "**" spans any number of segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ExpandBraces expands "{a,b}" groups into one pattern per alternative
+// Nested groups are expanded recursively; unbalanced braces are kept literally
+func ExpandBraces(pattern string) []string {
+	start, depth := -1, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			var expanded []string
+			for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+				expanded = append(expanded, ExpandBraces(prefix+alt+suffix)...)
+			}
+			return expanded
+		}
+	}
+	return []string{pattern}
+}
+
+// splitAlternatives splits the inside of a brace group on top-level commas
+func splitAlternatives(group string) []string {
+	var alts []string
+	last, depth := 0, 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, group[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(alts, group[last:])
+}
+
+// MatchesPath reports whether path matches this permission's path constraint
+// File tool rules such as "Write(src/**)" hold their glob in Command; other permissions in Pattern
+//
+// Patterns follow Claude Code's rule semantics:
+//   - "*" and "**" match every path
+//   - a pattern without a slash, such as "*.go", matches the file name at any depth below opts.BaseDir
+//   - "//abs/path" is absolute and "~/path" is relative to the home directory
+//   - other patterns, with or without a leading "/", are relative to opts.BaseDir
+//   - a trailing slash matches everything below the directory
+//
+// Paths are cleaned before matching, so "src/../secrets" does not match "src/**"
+func (tp *ToolPermission) MatchesPath(p string, opts MatchOptions) bool {
+	glob := tp.pathGlob()
+	if glob == "" {
+		return true // No pattern constraint means all patterns allowed
+	}
+	return matchPathGlob(glob, p, opts)
+}
+
+// pathGlob returns the glob constraining file paths, or "" when any path matches
+func (tp *ToolPermission) pathGlob() string {
+	if isFileTool(tp.Tool) && tp.Command != "" {
+		return tp.Command
+	}
+	return tp.Pattern
+}
+
+// isFileTool reports whether a rule's tool takes a path glob, e.g. "Edit(src/**)"
+func isFileTool(tool string) bool {
+	return editTools[tool] || readTools[tool]
+}
+
+// matchPathGlob matches a path against a permission glob
+func matchPathGlob(glob, p string, opts MatchOptions) bool {
+	if glob == "*" || glob == "**" {
+		return true
+	}
+
+	target := resolveMatchPath(p, opts)
+	for _, pattern := range ExpandBraces(glob) {
+		pattern = filepath.ToSlash(pattern)
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		if !strings.Contains(pattern, "/") {
+			if withinBase(target, opts) && MatchGlob(pattern, path.Base(target)) {
+				return true
+			}
+			continue
+		}
+		anchored := resolveMatchPattern(pattern, opts)
+		if path.IsAbs(anchored) == path.IsAbs(target) && MatchGlob(anchored, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesWithOptions returns true if the given tool, command, and path all match this permission
+func (tp *ToolPermission) MatchesWithOptions(tool, command, p string, opts MatchOptions) bool {
+	return tp.MatchesTool(tool) && tp.MatchesCommand(command) && tp.MatchesPath(p, opts)
+}
+
+// resolveMatchPath cleans a path and resolves it against the base directory in slash form
+func resolveMatchPath(p string, opts MatchOptions) string {
+	p = expandHome(p)
+	if !filepath.IsAbs(p) && opts.BaseDir != "" {
+		p = filepath.Join(matchBaseDir(opts), p)
+	}
+	p = filepath.Clean(p)
+	if opts.FollowSymlinks && filepath.IsAbs(p) {
+		p = evalExistingSymlinks(p)
+	}
+	return filepath.ToSlash(p)
+}
+
+// withinBase reports whether a resolved path lies inside the base directory
+// Without a base directory, only relative paths that do not climb out with ".." are inside
+func withinBase(target string, opts MatchOptions) bool {
+	if opts.BaseDir == "" {
+		return !path.IsAbs(target) && target != ".." && !strings.HasPrefix(target, "../")
+	}
+	base := filepath.ToSlash(matchBaseDir(opts))
+	return target == base || strings.HasPrefix(target, strings.TrimSuffix(base, "/")+"/")
+}
+
+// resolveMatchPattern anchors a slash pattern at the root, the home directory or the base directory
+func resolveMatchPattern(pattern string, opts MatchOptions) string {
+	switch {
+	case strings.HasPrefix(pattern, "//"):
+		return path.Clean(pattern[1:])
+	case strings.HasPrefix(pattern, "~/"):
+		return path.Clean(filepath.ToSlash(expandHome(pattern)))
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if opts.BaseDir == "" {
+		return path.Clean(pattern)
+	}
+	return path.Join(filepath.ToSlash(matchBaseDir(opts)), pattern)
+}
+
+// matchBaseDir returns the absolute base directory, with symlinks resolved if requested
+func matchBaseDir(opts MatchOptions) string {
+	base := expandHome(opts.BaseDir)
+	if abs, err := filepath.Abs(base); err == nil {
+		base = abs
+	}
+	if opts.FollowSymlinks {
+		base = evalExistingSymlinks(base)
+	}
+	return base
+}
+
+// expandHome replaces a leading "~/" with the user's home directory
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
+
+// evalExistingSymlinks resolves symlinks in the longest existing prefix of an absolute path
+// so paths of files that do not exist yet, such as Write targets, are resolved too
+func evalExistingSymlinks(p string) string {
+	dir, rest := p, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return p
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
@@ -0,0 +1,173 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"src/*.go", []string{"src/*.go"}},
+		{"{a,b}/*", []string{"a/*", "b/*"}},
+		{"*.{go,md}", []string{"*.go", "*.md"}},
+		{"{src,test}/**/*.{ts,tsx}", []string{"src/**/*.ts", "src/**/*.tsx", "test/**/*.ts", "test/**/*.tsx"}},
+		{"{a,{b,c}}d", []string{"ad", "bd", "cd"}},
+		{"x{,y}", []string{"x", "xy"}},
+		{"{unbalanced", []string{"{unbalanced"}},
+		{`\{a,b}`, []string{`\{a,b}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := ExpandBraces(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/claude/glob.go", true},
+		{"src/**/*.go", "src/pkg/README.md", false},
+		{"src/**/*.go", "test/main.go", false},
+		{"src/*", "src/main.go", true},
+		{"src/*", "src/pkg/main.go", false},
+		{"src/**", "src", true},
+		{"src/**", "src/a/b/c", true},
+		{"**/*_test.go", "glob_test.go", true},
+		{"**/*_test.go", "pkg/claude/glob_test.go", true},
+		{"{a,b}/*", "a/x", true},
+		{"{a,b}/*", "b/x", true},
+		{"{a,b}/*", "c/x", false},
+		{"docs/**/*.{md,txt}", "docs/guide/intro.txt", true},
+		{"file?.go", "file1.go", true},
+		{"file[0-9].go", "filex.go", false},
+		{"**/.env", "config/.env", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b", "a/b", true},
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			if got := MatchGlob(tt.pattern, tt.name); got != tt.want {
+				t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolPermission_MatchesPath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	base := filepath.FromSlash("/work/repo")
+	inBase := MatchOptions{BaseDir: base}
+
+	// Conformance with Claude Code's rule semantics for file patterns, on rules as the parser reads them
+	tests := []struct {
+		name string
+		rule string
+		path string
+		opts MatchOptions
+		want bool
+	}{
+		{"Relative pattern, relative path", "Edit(src/**)", "src/main.go", inBase, true},
+		{"Relative pattern, absolute path inside base", "Read(src/**)", "/work/repo/src/main.go", inBase, true},
+		{"Relative pattern, absolute path outside base", "Write(src/**)", "/other/src/main.go", inBase, false},
+		{"Leading slash is relative to base", "Edit(/src/**)", "/work/repo/src/main.go", inBase, true},
+		{"Leading slash does not mean filesystem root", "Read(/src/**)", "/src/main.go", inBase, false},
+		{"Double slash is absolute", "Write(//etc/**)", "/etc/hosts", inBase, true},
+		{"Home directory", "Edit(~/.ssh/**)", filepath.Join(home, ".ssh", "id_rsa"), inBase, true},
+		{"Parent traversal escapes", "Read(src/**)", "src/../secrets/key", inBase, false},
+		{"Parent traversal above base", "Write(src/**)", "../repo2/src/main.go", inBase, false},
+		{"Traversal that stays inside", "Edit(src/**)", "lib/../src/main.go", inBase, true},
+		{"Pattern with parent directory", "Read(../shared/**)", "/work/shared/util.go", inBase, true},
+		{"Name pattern at any depth", "Write(*.go)", "/work/repo/pkg/deep/main.go", inBase, true},
+		{"Name pattern miss", "Edit(*.go)", "pkg/main.js", inBase, false},
+		{"Name pattern outside base", "Read(*.go)", "/etc/x.go", inBase, false},
+		{"Name pattern in home outside base", "Write(*.go)", filepath.Join(home, ".ssh", "x.go"), inBase, false},
+		{"Name pattern escaping base", "Edit(.env)", "../other/.env", inBase, false},
+		{"Name pattern in a sibling with the base as prefix", "Read(*.go)", "/work/repo2/main.go", inBase, false},
+		{"Exact file name at any depth", "Write(.env)", "config/.env", inBase, true},
+		{"Trailing slash is a directory", "Edit(docs/)", "docs/guide/intro.md", inBase, true},
+		{"Brace alternatives", "Read({src,test}/**/*.go)", "test/unit/a_test.go", inBase, true},
+		{"Doublestar in the middle", "Write(src/**/*.go)", "src/a/b/c.go", inBase, true},
+		{"Star matches everything", "Edit(*)", "/anywhere/at/all", inBase, true},
+		{"No base: relative only", "Read(src/**)", "src/main.go", MatchOptions{}, true},
+		{"No base: absolute path", "Write(src/**)", "/work/repo/src/main.go", MatchOptions{}, false},
+		{"Parsed rule rejects paths outside base", "Write(src/**)", "/etc/passwd", MatchOptions{BaseDir: "/work"}, false},
+		{"Parsed rule rejects traversal", "Write(src/**)", "../secret", MatchOptions{}, false},
+		{"Bare rule matches any path", "Read", "/etc/passwd", inBase, true},
+		{"No base: traversal", "Edit(src/**)", "src/../../etc/passwd", MatchOptions{}, false},
+		{"No base: name pattern, relative path", "Read(*.go)", "pkg/main.go", MatchOptions{}, true},
+		{"No base: name pattern, absolute path", "Write(*.go)", "/etc/x.go", MatchOptions{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perm, err := ParseToolPermission(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := perm.MatchesPath(filepath.FromSlash(tt.path), tt.opts); got != tt.want {
+				t.Errorf("MatchesPath(%q) with rule %s = %v, want %v", tt.path, tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolPermission_MatchesPatternParsedRules(t *testing.T) {
+	perm, err := ParseToolPermission("Write(src/**)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm.MatchesPattern("../secret") || !perm.MatchesPattern("src/main.go") {
+		t.Error("Expected MatchesPattern to use the rule's glob")
+	}
+	if perm.Matches("Write", "", "../secret") || !perm.Matches("Write", "", "src/main.go") {
+		t.Error("Expected Matches to check the path glob of a file rule")
+	}
+}
+
+func TestToolPermission_MatchesPathSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(repo, "src"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// src/link points outside the repository
+	if err := os.Symlink(outside, filepath.Join(repo, "src", "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	perm, err := ParseToolPermission("Edit(src/**)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "src/link/secret.txt"
+	if !perm.MatchesPath(target, MatchOptions{BaseDir: repo}) {
+		t.Error("Expected lexical matching to accept the link path")
+	}
+	if perm.MatchesPath(target, MatchOptions{BaseDir: repo, FollowSymlinks: true}) {
+		t.Error("Expected symlink-aware matching to reject a link leaving src")
+	}
+	if !perm.MatchesPath("src/new/file.go", MatchOptions{BaseDir: repo, FollowSymlinks: true}) {
+		t.Error("Expected paths that do not exist yet to match")
+	}
+}
@@ -0,0 +1,211 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marvai-dev/claude-code-go/pkg/claude/buffer"
+)
+
+// WithLogger logs every CLI invocation made by the client to logger
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *ClaudeClient) {
+		c.Logger = logger
+	}
+}
+
+// redactedFlags hold prompt text or inline configuration that may contain secrets
+var redactedFlags = map[string]bool{
+	"--system-prompt":        true,
+	"--append-system-prompt": true,
+	"--mcp-config":           true,
+	"--settings":             true,
+}
+
+// RedactArgs returns a copy of args built by BuildArgs with the prompt and sensitive values replaced
+// Config paths passed to --mcp-config and --settings are kept; inline JSON is redacted
+func RedactArgs(prompt string, args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 0; i < len(redacted); i++ {
+		switch {
+		case i == 1 && prompt != "" && redacted[0] == "-p" && redacted[i] == prompt:
+			redacted[i] = redactedValue(prompt)
+		case redactedFlags[redacted[i]] && i+1 < len(redacted):
+			value := redacted[i+1]
+			if redacted[i] != "--system-prompt" && redacted[i] != "--append-system-prompt" && !strings.HasPrefix(strings.TrimSpace(value), "{") {
+				continue // A file path
+			}
+			redacted[i+1] = redactedValue(value)
+			i++
+		}
+	}
+
+	return redacted
+}
+
+// redactedValue describes a redacted argument without revealing it
+func redactedValue(value string) string {
+	return fmt.Sprintf("[redacted %d bytes]", len(value))
+}
+
+// Invocation describes one CLI process for logging
+type Invocation struct {
+	// Args are the redacted command-line arguments
+	Args []string
+	// Dir is the working directory of the process
+	Dir string
+	// PID is the process ID, or 0 if the process did not start
+	PID int
+	// Start is when the invocation began
+	Start time.Time
+	// Duration is how long the process ran
+	Duration time.Duration
+	// ExitCode is the process exit code, or -1 if it did not exit
+	ExitCode int
+	// StdoutBytes and StderrBytes are the sizes of the captured output
+	StdoutBytes int64
+	StderrBytes int64
+	// StdoutTruncated and StderrTruncated report whether output exceeded the buffer limits
+	StdoutTruncated bool
+	StderrTruncated bool
+	// Messages counts streamed messages by type (streaming only)
+	Messages map[string]int
+	// Tools counts tool uses by tool name (streaming only)
+	Tools map[string]int
+	// Format and Model describe the run
+	Format string
+	Model  string
+}
+
+// NewInvocation starts describing a CLI invocation
+// This is exported for use by the dangerous package
+func NewInvocation(prompt string, args []string, opts *RunOptions) *Invocation {
+	inv := &Invocation{
+		Args:     RedactArgs(prompt, args),
+		Start:    time.Now(),
+		ExitCode: -1,
+	}
+	if opts != nil {
+		inv.Dir = opts.WorkingDir
+		inv.Format = string(opts.Format)
+		inv.Model = opts.ModelAlias
+		if inv.Model == "" {
+			inv.Model = opts.Model
+		}
+	}
+	return inv
+}
+
+// Finish records the outcome of the process and its captured output
+// Either buffer may be nil
+// This is exported for use by the dangerous package
+func (inv *Invocation) Finish(cmd *exec.Cmd, stdout, stderr buffer.Output) {
+	inv.Duration = time.Since(inv.Start)
+	if cmd != nil {
+		if cmd.Process != nil {
+			inv.PID = cmd.Process.Pid
+		}
+		if cmd.ProcessState != nil {
+			inv.ExitCode = cmd.ProcessState.ExitCode()
+		}
+	}
+	if stdout != nil {
+		inv.StdoutBytes = stdout.Size()
+		inv.StdoutTruncated = stdout.Truncated()
+	}
+	if stderr != nil {
+		inv.StderrBytes = stderr.Size()
+		inv.StderrTruncated = stderr.Truncated()
+	}
+}
+
+// LogInvocation logs a finished invocation to the client's Logger, if any
+// Successful runs are logged at info level and failures at warn level with the classified error type
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) LogInvocation(ctx context.Context, inv *Invocation, err error) {
+	if c.Logger == nil || inv == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Any("args", inv.Args),
+		slog.String("dir", inv.Dir),
+		slog.Int("pid", inv.PID),
+		slog.Duration("duration", inv.Duration),
+		slog.Int("exit_code", inv.ExitCode),
+		slog.Int64("stdout_bytes", inv.StdoutBytes),
+		slog.Int64("stderr_bytes", inv.StderrBytes),
+		slog.Bool("stdout_truncated", inv.StdoutTruncated),
+		slog.Bool("stderr_truncated", inv.StderrTruncated),
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("error_type", errorTypeOf(err)), slog.String("error", err.Error()))
+		if kind := TimeoutKindOf(err); kind != "" {
+			attrs = append(attrs, slog.String("timeout_kind", string(kind)))
+		}
+	}
+	c.Logger.LogAttrs(ctx, level, "claude invocation", attrs...)
+
+	if inv.Messages != nil {
+		types := make([]string, 0, len(inv.Messages))
+		total := 0
+		for messageType, count := range inv.Messages {
+			types = append(types, messageType)
+			total += count
+		}
+		sort.Strings(types)
+		counts := make([]any, 0, len(types))
+		for _, messageType := range types {
+			counts = append(counts, slog.Int(messageType, inv.Messages[messageType]))
+		}
+		c.Logger.LogAttrs(ctx, slog.LevelDebug, "claude stream messages",
+			slog.Int("pid", inv.PID),
+			slog.Int("total", total),
+			slog.Group("by_type", counts...),
+		)
+	}
+}
+
+// logRetry logs a scheduled retry or the end of retrying
+func (c *ClaudeClient) logRetry(ctx context.Context, attempt int, err error, delay time.Duration, reason string) {
+	if c.Logger == nil {
+		return
+	}
+
+	if reason == "" {
+		c.Logger.LogAttrs(ctx, slog.LevelInfo, "claude retry",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.String("error_type", errorTypeOf(err)),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	c.Logger.LogAttrs(ctx, slog.LevelWarn, "claude retries stopped",
+		slog.Int("attempts", attempt),
+		slog.String("reason", reason),
+		slog.String("error_type", errorTypeOf(err)),
+		slog.String("error", err.Error()),
+	)
+}
+
+// errorTypeOf returns the classified error type of err, or "" for errors that are not ClaudeErrors
+func errorTypeOf(err error) string {
+	var claudeErr *ClaudeError
+	if errors.As(err, &claudeErr) {
+		return claudeErr.Type.String()
+	}
+	return ""
+}
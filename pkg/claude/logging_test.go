@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactArgs(t *testing.T) {
+	opts := &RunOptions{
+		Format:        JSONOutput,
+		SystemPrompt:  "You are a secret agent",
+		MCPConfigPath: "/etc/mcp.json",
+		MCPServers:    map[string]MCPServerConfig{"db": {Command: "db", Env: map[string]string{"TOKEN": "s3cret"}}},
+		Model:         "sonnet",
+	}
+	prompt := "summarize the credentials file"
+	args := BuildArgs(prompt, opts)
+
+	redacted := RedactArgs(prompt, args)
+	joined := strings.Join(redacted, " ")
+	for _, secret := range []string{prompt, "secret agent", "s3cret"} {
+		if strings.Contains(joined, secret) {
+			t.Errorf("Expected %q to be redacted from %v", secret, redacted)
+		}
+	}
+	for _, kept := range []string{"--output-format json", "--mcp-config /etc/mcp.json", "--model sonnet"} {
+		if !strings.Contains(joined, kept) {
+			t.Errorf("Expected %q to be kept in %v", kept, redacted)
+		}
+	}
+	if args[1] != prompt {
+		t.Error("Expected RedactArgs to leave the original args untouched")
+	}
+}
+
+// decodeLogs parses JSON log records written by slog.JSONHandler
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid log record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogger_Invocations(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewClient("claude", WithLogger(logger))
+
+	t.Run("failed run", func(t *testing.T) {
+		buf.Reset()
+		execCommand = mockExecCommandStderr("", "Error: Rate limit exceeded", 1)
+
+		client.RunPromptCtx(context.Background(), "secret prompt", &RunOptions{Format: JSONOutput, WorkingDir: t.TempDir()})
+
+		records := decodeLogs(t, &buf)
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record, got %d", len(records))
+		}
+		r := records[0]
+		if r["msg"] != "claude invocation" || r["level"] != "WARN" || r["error_type"] != "rate_limit" {
+			t.Errorf("Unexpected record: %v", r)
+		}
+		if r["exit_code"] != float64(1) || r["pid"] == float64(0) || r["dir"] == "" || r["stderr_bytes"] == float64(0) {
+			t.Errorf("Expected process details, got %v", r)
+		}
+		if strings.Contains(buf.String(), "secret prompt") {
+			t.Error("Expected prompt to be redacted")
+		}
+	})
+
+	t.Run("stream message counts", func(t *testing.T) {
+		buf.Reset()
+		output := `{"type":"system","subtype":"init","session_id":"abc"}` + "\n" +
+			`{"type":"assistant","session_id":"abc"}` + "\n" +
+			`{"type":"assistant","session_id":"abc"}` + "\n" +
+			`{"type":"result","result":"ok","session_id":"abc"}` + "\n"
+		execCommand = mockExecCommandStderr(output, "", 0)
+
+		if _, err := collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{})); err != nil {
+			t.Fatal(err)
+		}
+
+		records := decodeLogs(t, &buf)
+		if len(records) != 2 {
+			t.Fatalf("Expected invocation and message count records, got %d", len(records))
+		}
+		if records[0]["level"] != "INFO" || records[0]["stdout_bytes"] != float64(len(output)) {
+			t.Errorf("Unexpected invocation record: %v", records[0])
+		}
+		counts, _ := records[1]["by_type"].(map[string]interface{})
+		if records[1]["level"] != "DEBUG" || records[1]["total"] != float64(4) || counts["assistant"] != float64(2) {
+			t.Errorf("Unexpected message count record: %v", records[1])
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		buf.Reset()
+		execCommand = mockExecCommandStderr("", "network error: connection reset", 1)
+
+		policy := &RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+		client.RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, policy)
+
+		var messages []string
+		for _, r := range decodeLogs(t, &buf) {
+			messages = append(messages, r["msg"].(string))
+		}
+		want := "claude invocation,claude retry,claude invocation,claude retries stopped"
+		if strings.Join(messages, ",") != want {
+			t.Errorf("Expected %s, got %v", want, messages)
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the invocation duration histogram
+var DefaultLatencyBuckets = []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// ClientMetrics collects client activity and exposes it in Prometheus text format
+// It is safe for concurrent use and may be shared by several clients
+// The zero value is ready to use with DefaultLatencyBuckets
+type ClientMetrics struct {
+	mu sync.Mutex
+
+	invocations map[[3]string]int64 // format, model, outcome
+	errors      map[ErrorType]int64
+	toolUses    map[string]int64
+	retries     int64
+	inFlight    int64
+	costUSD     float64
+	tokens      map[string]int64
+
+	buckets      []float64
+	bucketCounts []int64
+	latencySum   float64
+	latencyCount int64
+}
+
+// NewClientMetrics creates empty metrics using DefaultLatencyBuckets
+func NewClientMetrics() *ClientMetrics {
+	m := &ClientMetrics{}
+	m.init()
+	return m
+}
+
+// init allocates the counters on first use so the zero value works; m.mu must be held
+func (m *ClientMetrics) init() {
+	if m.invocations != nil {
+		return
+	}
+	m.invocations = make(map[[3]string]int64)
+	m.errors = make(map[ErrorType]int64)
+	m.toolUses = make(map[string]int64)
+	m.tokens = make(map[string]int64)
+	m.buckets = DefaultLatencyBuckets
+	m.bucketCounts = make([]int64, len(DefaultLatencyBuckets))
+}
+
+// WithMetrics records the client's activity in metrics
+func WithMetrics(metrics *ClientMetrics) ClientOption {
+	return func(c *ClaudeClient) {
+		c.Metrics = metrics
+	}
+}
+
+// ReportInvocation logs a finished invocation and records it in the client's metrics
+// result may be nil when the run produced no result
+// This is exported for use by the dangerous package
+func (c *ClaudeClient) ReportInvocation(ctx context.Context, inv *Invocation, result *ClaudeResult, err error) {
+	c.LogInvocation(ctx, inv, err)
+	if c.Metrics != nil {
+		c.Metrics.observeInvocation(inv, result, err)
+	}
+}
+
+// observeInvocation records a finished invocation
+func (m *ClientMetrics) observeInvocation(inv *Invocation, result *ClaudeResult, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	m.invocations[[3]string{inv.Format, inv.Model, outcome}]++
+
+	if err != nil {
+		errorType := ErrorUnknown
+		var claudeErr *ClaudeError
+		if errors.As(err, &claudeErr) {
+			errorType = claudeErr.Type
+		}
+		m.errors[errorType]++
+	}
+
+	seconds := inv.Duration.Seconds()
+	m.latencySum += seconds
+	m.latencyCount++
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			m.bucketCounts[i]++
+		}
+	}
+
+	for tool, count := range inv.Tools {
+		m.toolUses[tool] += int64(count)
+	}
+
+	if result != nil {
+		m.costUSD += result.CostUSD
+		if usage := result.Usage; usage != nil {
+			m.tokens["input"] += usage.InputTokens
+			m.tokens["output"] += usage.OutputTokens
+			m.tokens["cache_creation"] += usage.CacheCreationInputTokens
+			m.tokens["cache_read"] += usage.CacheReadInputTokens
+		}
+	}
+}
+
+// processStarted and processEnded track processes in flight
+func (m *ClientMetrics) processStarted() {
+	m.mu.Lock()
+	m.inFlight++
+	m.mu.Unlock()
+}
+
+func (m *ClientMetrics) processEnded() {
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+}
+
+// recordRetry counts a scheduled retry
+func (m *ClientMetrics) recordRetry() {
+	m.mu.Lock()
+	m.retries++
+	m.mu.Unlock()
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format
+func (m *ClientMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	cw.header("claude_invocations_total", "counter", "CLI invocations by output format, model and outcome.")
+	invocationKeys := make([][3]string, 0, len(m.invocations))
+	for key := range m.invocations {
+		invocationKeys = append(invocationKeys, key)
+	}
+	sort.Slice(invocationKeys, func(i, j int) bool {
+		return strings.Join(invocationKeys[i][:], "\x00") < strings.Join(invocationKeys[j][:], "\x00")
+	})
+	for _, key := range invocationKeys {
+		cw.sample("claude_invocations_total", labels("format", key[0], "model", key[1], "outcome", key[2]), float64(m.invocations[key]))
+	}
+
+	cw.header("claude_errors_total", "counter", "Failed invocations by error type.")
+	errorTypes := make([]ErrorType, 0, len(m.errors))
+	for errorType := range m.errors {
+		errorTypes = append(errorTypes, errorType)
+	}
+	sort.Slice(errorTypes, func(i, j int) bool { return errorTypes[i] < errorTypes[j] })
+	for _, errorType := range errorTypes {
+		cw.sample("claude_errors_total", labels("type", errorType.String()), float64(m.errors[errorType]))
+	}
+
+	cw.header("claude_invocation_duration_seconds", "histogram", "Duration of CLI invocations.")
+	for i, bound := range m.buckets {
+		cw.sample("claude_invocation_duration_seconds_bucket", labels("le", formatFloat(bound)), float64(m.bucketCounts[i]))
+	}
+	cw.sample("claude_invocation_duration_seconds_bucket", labels("le", "+Inf"), float64(m.latencyCount))
+	cw.sample("claude_invocation_duration_seconds_sum", "", m.latencySum)
+	cw.sample("claude_invocation_duration_seconds_count", "", float64(m.latencyCount))
+
+	cw.header("claude_cost_usd_total", "counter", "Cost of completed runs in US dollars.")
+	cw.sample("claude_cost_usd_total", "", m.costUSD)
+
+	cw.header("claude_tokens_total", "counter", "Tokens used by completed runs by kind.")
+	for _, kind := range sortedKeys(m.tokens) {
+		cw.sample("claude_tokens_total", labels("kind", kind), float64(m.tokens[kind]))
+	}
+
+	cw.header("claude_tool_uses_total", "counter", "Tool uses in streamed runs by tool name.")
+	for _, tool := range sortedKeys(m.toolUses) {
+		cw.sample("claude_tool_uses_total", labels("tool", tool), float64(m.toolUses[tool]))
+	}
+
+	cw.header("claude_processes_in_flight", "gauge", "CLI processes currently running.")
+	cw.sample("claude_processes_in_flight", "", float64(m.inFlight))
+
+	cw.header("claude_retries_total", "counter", "Retries scheduled after failed attempts.")
+	cw.sample("claude_retries_total", "", float64(m.retries))
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP exposes the metrics for scraping
+func (m *ClientMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// Handler returns an http.Handler that exposes the metrics in Prometheus text format
+func (m *ClientMetrics) Handler() http.Handler {
+	return m
+}
+
+// countingWriter writes exposition lines and keeps the first error
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func (cw *countingWriter) header(name, metricType, help string) {
+	cw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (cw *countingWriter) sample(name, labels string, value float64) {
+	cw.printf("%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// labels formats label pairs as {k="v",...}
+func labels(pairs ...string) string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(pairs[i])
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(pairs[i+1]))
+		sb.WriteString(`"`)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// labelEscaper escapes label values as required by the text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatFloat formats a sample value
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a counter map in order
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
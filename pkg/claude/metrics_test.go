@@ -0,0 +1,111 @@
+package claude
+
+import (
+	"context"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientMetrics(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	metrics := NewClientMetrics()
+	client := NewClient("claude", WithMetrics(metrics))
+	ctx := context.Background()
+
+	// A successful JSON run with cost and usage
+	execCommand = mockExecCommandStderr(`{"type":"result","result":"ok","session_id":"abc","cost_usd":0.5,"usage":{"input_tokens":100,"output_tokens":20}}`, "", 0)
+	if _, err := client.RunPromptCtx(ctx, "test", &RunOptions{Format: JSONOutput, Model: "sonnet"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed run retried once
+	calls := 0
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		if calls == 1 {
+			return mockExecCommandStderr("", "network error: connection reset", 1)(ctx, name, arg...)
+		}
+		return mockExecCommandStderr(`{"type":"result","result":"ok","session_id":"abc"}`, "", 0)(ctx, name, arg...)
+	}
+	policy := &RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+	if _, err := client.RunPromptWithRetryCtx(ctx, "test", &RunOptions{Format: JSONOutput, Model: "sonnet"}, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	// A streamed run with tool uses
+	output := strings.Join([]string{
+		`{"type":"assistant","session_id":"abc","message":{"id":"m1","content":[{"type":"tool_use","id":"t1","name":"Bash"},{"type":"tool_use","id":"t2","name":"Bash"}]}}`,
+		`{"type":"result","result":"ok","session_id":"abc","cost_usd":0.25}`,
+	}, "\n") + "\n"
+	execCommand = mockExecCommandStderr(output, "", 0)
+	if _, err := collectStream(client.StreamPrompt(ctx, "test", &RunOptions{})); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`claude_invocations_total{format="json",model="sonnet",outcome="success"} 2`,
+		`claude_invocations_total{format="json",model="sonnet",outcome="error"} 1`,
+		`claude_invocations_total{format="stream-json",model="",outcome="success"} 1`,
+		`claude_errors_total{type="network"} 1`,
+		`claude_invocation_duration_seconds_bucket{le="+Inf"} 4`,
+		`claude_invocation_duration_seconds_count 4`,
+		`claude_cost_usd_total 0.75`,
+		`claude_tokens_total{kind="input"} 100`,
+		`claude_tokens_total{kind="output"} 20`,
+		`claude_tool_uses_total{tool="Bash"} 2`,
+		`claude_processes_in_flight 0`,
+		`claude_retries_total 1`,
+		`# TYPE claude_invocation_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("Expected %q in metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestClientMetrics_ZeroValue(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecCommandStderr("", "network error: connection reset", 1)
+
+	metrics := &ClientMetrics{}
+	client := NewClient("claude", WithMetrics(metrics))
+	client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput})
+
+	var buf strings.Builder
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`claude_errors_total{type="network"} 1`,
+		`claude_invocation_duration_seconds_bucket{le="1"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestLabels_Escaping(t *testing.T) {
+	got := labels("tool", "a\"b\\c\nd")
+	want := `{tool="a\"b\\c\nd"}`
+	if got != want {
+		t.Errorf("labels() = %s, want %s", got, want)
+	}
+}
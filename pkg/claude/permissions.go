@@ -2,7 +2,6 @@ package claude
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 )
 
@@ -17,51 +16,43 @@ type ToolPermission struct {
 // ParseToolPermission parses tool permission strings supporting both legacy and enhanced formats
 //
 // Supported formats:
-//   - Legacy: "Bash", "Write", "mcp__filesystem__read_file"
-//   - Enhanced: "Bash(git log)", "Bash(git log:*)", "Write(src/**)"
-//   - Complex: "Bash(npm install:package.json)", "Write(/src/**:/test/**)"
+//   - Legacy: "Bash", "Write", "mcp__filesystem__read_file", "mcp__github" (every tool of a server)
+//   - Enhanced: "Bash(git log)", "Bash(git log:*)", "Write(src/**)", "Read(//abs/path/**)", "Read(~/notes/**)"
+//   - Domain: "WebFetch(domain:example.com)"
+//
+// The specifier inside the parentheses may contain colons and balanced parentheses, e.g. "Bash(npm run test:unit)"
+// or "Bash(echo $(date))". Only a trailing ":*" becomes the Pattern, marking a prefix rule, and WebFetch's
+// "domain:" prefix becomes Command "domain" with the host as Pattern; everything else is the Command
+// "\:", "\(" and "\)" stand for a literal colon or parenthesis
+//
+// Invalid rules return a *PermissionSyntaxError with the offending position
 func ParseToolPermission(permission string) (*ToolPermission, error) {
-	if permission == "" {
-		return nil, fmt.Errorf("empty permission string")
+	if strings.TrimSpace(permission) == "" {
+		return nil, &PermissionSyntaxError{Rule: permission, Message: "empty permission string"}
 	}
 
-	// Handle legacy format: "Bash", "Write", etc.
-	if !strings.Contains(permission, "(") {
-		return &ToolPermission{
-			Tool:     strings.TrimSpace(permission),
-			Original: permission,
-		}, nil
+	s := &permissionScanner{src: permission}
+	s.skipSpace()
+	tool, err := s.toolName()
+	if err != nil {
+		return nil, err
 	}
 
-	// Parse enhanced format: "Tool(command:pattern)" or "Tool(command)"
-	// Regex explanation:
-	// ^([^(]+) - Capture tool name (everything before first '(')
-	// \( - Literal opening parenthesis
-	// ([^:)]+) - Capture command (everything until ':' or ')')
-	// (?::([^:)]+))? - Optional group: ':' followed by pattern (no more colons allowed)
-	// \)$ - Literal closing parenthesis at end
-	re := regexp.MustCompile(`^([^(]+)\(([^:)]+)(?::([^:)]+))?\)$`)
-	matches := re.FindStringSubmatch(permission)
-
-	if len(matches) < 3 {
-		return nil, fmt.Errorf("invalid tool permission format: %s (expected format: Tool(command) or Tool(command:pattern))", permission)
+	s.skipSpace()
+	if s.done() {
+		return &ToolPermission{Tool: tool, Original: permission}, nil
 	}
-
-	tool := strings.TrimSpace(matches[1])
-	command := strings.TrimSpace(matches[2])
-	pattern := ""
-	if len(matches) > 3 && matches[3] != "" {
-		pattern = strings.TrimSpace(matches[3])
+	if s.peek() != '(' {
+		return nil, s.errorf(s.pos, "unexpected %q after tool name", s.peek())
 	}
 
-	// Validate tool name is not empty
-	if tool == "" {
-		return nil, fmt.Errorf("tool name cannot be empty in permission: %s", permission)
+	command, pattern, err := s.specifier(tool)
+	if err != nil {
+		return nil, err
 	}
-
-	// Validate command is not empty when specified
-	if command == "" {
-		return nil, fmt.Errorf("command cannot be empty in permission: %s", permission)
+	s.skipSpace()
+	if !s.done() {
+		return nil, s.errorf(s.pos, "unexpected %q after closing parenthesis", s.peek())
 	}
 
 	return &ToolPermission{
@@ -72,6 +63,153 @@ func ParseToolPermission(permission string) (*ToolPermission, error) {
 	}, nil
 }
 
+// PermissionSyntaxError describes an invalid permission rule
+type PermissionSyntaxError struct {
+	Rule string
+	// Pos is the byte offset of the error in Rule
+	Pos     int
+	Message string
+}
+
+// Error implements the error interface
+func (e *PermissionSyntaxError) Error() string {
+	if e.Rule == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("invalid tool permission %q at position %d: %s", e.Rule, e.Pos, e.Message)
+}
+
+// permissionScanner tokenizes a permission rule
+type permissionScanner struct {
+	src string
+	pos int
+}
+
+// done reports whether the whole rule has been read
+func (s *permissionScanner) done() bool {
+	return s.pos >= len(s.src)
+}
+
+// peek returns the current byte
+func (s *permissionScanner) peek() byte {
+	return s.src[s.pos]
+}
+
+// skipSpace skips whitespace
+func (s *permissionScanner) skipSpace() {
+	for !s.done() && isPermissionSpace(s.peek()) {
+		s.pos++
+	}
+}
+
+// errorf returns a syntax error at pos
+func (s *permissionScanner) errorf(pos int, format string, args ...interface{}) *PermissionSyntaxError {
+	return &PermissionSyntaxError{Rule: s.src, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// toolName reads a tool name such as "Bash", "mcp__github" or "mcp__github__*"
+func (s *permissionScanner) toolName() (string, error) {
+	start := s.pos
+	for !s.done() && isToolNameByte(s.peek()) {
+		s.pos++
+	}
+	tool := s.src[start:s.pos]
+	if tool == "" {
+		if s.done() || s.peek() == '(' {
+			return "", s.errorf(s.pos, "tool name cannot be empty")
+		}
+		return "", s.errorf(s.pos, "unexpected %q in tool name", s.peek())
+	}
+
+	if strings.HasPrefix(tool, "mcp__") {
+		server, name, hasTool := strings.Cut(strings.TrimPrefix(tool, "mcp__"), "__")
+		if server == "" {
+			return "", s.errorf(start+len("mcp__"), "MCP rule is missing a server name")
+		}
+		if hasTool && name == "" {
+			return "", s.errorf(start+len("mcp__")+len(server)+len("__"), "MCP rule is missing a tool name")
+		}
+	}
+	return tool, nil
+}
+
+// specifier reads "(command)" starting at the opening parenthesis
+// Only a trailing ":*" and WebFetch's "domain:" prefix split off a pattern; other colons belong to the command
+func (s *permissionScanner) specifier(tool string) (command, pattern string, err error) {
+	open := s.pos
+	s.pos++
+
+	var current strings.Builder
+	firstColon, lastColon := -1, -1 // offsets in current of unescaped top-level colons
+	colonPos := -1                  // position in the rule of the first such colon
+	var nested []int                // positions of unclosed nested parentheses
+
+	for !s.done() {
+		c := s.peek()
+		switch {
+		case c == '\\' && s.pos+1 < len(s.src):
+			next := s.src[s.pos+1]
+			if next != '(' && next != ')' && next != ':' && next != '\\' {
+				// Other escapes, such as glob escapes, are kept as written
+				current.WriteByte(c)
+			}
+			current.WriteByte(next)
+			s.pos += 2
+			continue
+		case c == '(':
+			nested = append(nested, s.pos)
+		case c == ')' && len(nested) > 0:
+			nested = nested[:len(nested)-1]
+		case c == ')':
+			s.pos++
+			return s.splitSpecifier(tool, open, current.String(), firstColon, lastColon, colonPos)
+		case c == ':' && len(nested) == 0:
+			if firstColon < 0 {
+				firstColon, colonPos = current.Len(), s.pos
+			}
+			lastColon = current.Len()
+		}
+		current.WriteByte(c)
+		s.pos++
+	}
+
+	if len(nested) > 0 {
+		return "", "", s.errorf(nested[len(nested)-1], "unclosed parenthesis")
+	}
+	return "", "", s.errorf(open, "unclosed parenthesis")
+}
+
+// splitSpecifier separates a trailing ":*" prefix marker or a WebFetch "domain:" prefix from the command
+func (s *permissionScanner) splitSpecifier(tool string, open int, spec string, firstColon, lastColon, colonPos int) (string, string, error) {
+	command, pattern := spec, ""
+	switch {
+	case tool == "WebFetch" && firstColon >= 0 && strings.TrimSpace(spec[:firstColon]) == "domain":
+		command, pattern = "domain", strings.TrimSpace(spec[firstColon+1:])
+		if pattern == "" {
+			return "", "", s.errorf(colonPos+1, "domain cannot be empty after 'domain:'")
+		}
+	case lastColon >= 0 && strings.TrimSpace(spec[lastColon+1:]) == "*":
+		command, pattern = spec[:lastColon], "*"
+	}
+
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return "", "", s.errorf(open+1, "command cannot be empty")
+	}
+	return command, pattern, nil
+}
+
+// isToolNameByte reports whether c may appear in a tool name
+func isToolNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isPermissionSpace reports whether c is whitespace around rule tokens
+func isPermissionSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
 // ParseToolPermissions parses a slice of tool permission strings
 func ParseToolPermissions(permissions []string) ([]ToolPermission, error) {
 	var parsed []ToolPermission
@@ -125,7 +263,8 @@ func (tp *ToolPermission) MatchesTool(tool string) bool {
 // MatchesCommand returns true if the given command matches this permission's command constraint
 // If no command constraint is specified, returns true (allows all commands)
 func (tp *ToolPermission) MatchesCommand(command string) bool {
-	if !tp.HasCommand() {
+	// File tool rules such as "Write(src/**)" constrain paths, not commands
+	if !tp.HasCommand() || isFileTool(tp.Tool) {
 		return true // No command constraint means all commands allowed
 	}
 	return tp.Command == command
@@ -133,41 +272,9 @@ func (tp *ToolPermission) MatchesCommand(command string) bool {
 
 // MatchesPattern returns true if the given path/pattern matches this permission's pattern constraint
 // If no pattern constraint is specified, returns true (allows all patterns)
+// Relative patterns only match relative paths; use MatchesPath to resolve against a working directory
 func (tp *ToolPermission) MatchesPattern(path string) bool {
-	if !tp.HasPattern() {
-		return true // No pattern constraint means all patterns allowed
-	}
-	
-	// Simple glob-like matching for now
-	// TODO: Implement full glob pattern matching if needed
-	if tp.Pattern == "*" {
-		return true
-	}
-	
-	// Check for exact match first
-	if tp.Pattern == path {
-		return true
-	}
-	
-	// Check for prefix match with double wildcard
-	if strings.HasSuffix(tp.Pattern, "**") {
-		prefix := strings.TrimSuffix(tp.Pattern, "**")
-		return strings.HasPrefix(path, prefix)
-	}
-	
-	// Check for prefix match with single wildcard
-	if strings.HasSuffix(tp.Pattern, "*") {
-		prefix := strings.TrimSuffix(tp.Pattern, "*")
-		return strings.HasPrefix(path, prefix)
-	}
-	
-	// Check for suffix match (e.g., "*.go" matches "main.go")
-	if strings.HasPrefix(tp.Pattern, "*") {
-		suffix := strings.TrimPrefix(tp.Pattern, "*")
-		return strings.HasSuffix(path, suffix)
-	}
-	
-	return false
+	return tp.MatchesPath(path, MatchOptions{})
 }
 
 // Matches returns true if the given tool, command, and path all match this permission
@@ -1,6 +1,7 @@
 package claude
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -67,12 +68,12 @@ func TestParseToolPermission(t *testing.T) {
 			expectError: false,
 		},
 		{
-			name:       "Enhanced format - complex pattern",
+			name:       "Enhanced format - colon inside the command",
 			permission: "Bash(npm install:package.json)",
 			want: ToolPermission{
 				Tool:     "Bash",
-				Command:  "npm install",
-				Pattern:  "package.json",
+				Command:  "npm install:package.json",
+				Pattern:  "",
 				Original: "Bash(npm install:package.json)",
 			},
 			expectError: false,
@@ -102,8 +103,118 @@ func TestParseToolPermission(t *testing.T) {
 			expectError: true,
 		},
 		{
-			name:        "Error - invalid format",
-			permission:  "Bash(git log:pattern:extra)",
+			name:       "Full syntax - colon in a script name",
+			permission: "Bash(npm run test:unit)",
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "npm run test:unit",
+				Pattern:  "",
+				Original: "Bash(npm run test:unit)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - colons in arguments",
+			permission: "Bash(docker run -p 8080:80 nginx)",
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "docker run -p 8080:80 nginx",
+				Pattern:  "",
+				Original: "Bash(docker run -p 8080:80 nginx)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - only a trailing :* is a prefix",
+			permission: "Bash(git log:pattern:*)",
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "git log:pattern",
+				Pattern:  "*",
+				Original: "Bash(git log:pattern:*)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - prefix with a colon inside the command",
+			permission: "Bash(npm run test:*)",
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "npm run test",
+				Pattern:  "*",
+				Original: "Bash(npm run test:*)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - escaped colon",
+			permission: `Bash(docker run -p 8080\:80)`,
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "docker run -p 8080:80",
+				Pattern:  "",
+				Original: `Bash(docker run -p 8080\:80)`,
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - nested parentheses",
+			permission: "Bash(echo $(date):*)",
+			want: ToolPermission{
+				Tool:     "Bash",
+				Command:  "echo $(date)",
+				Pattern:  "*",
+				Original: "Bash(echo $(date):*)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - WebFetch domain",
+			permission: "WebFetch(domain:example.com)",
+			want: ToolPermission{
+				Tool:     "WebFetch",
+				Command:  "domain",
+				Pattern:  "example.com",
+				Original: "WebFetch(domain:example.com)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - absolute path",
+			permission: "Read(//abs/path/**)",
+			want: ToolPermission{
+				Tool:     "Read",
+				Command:  "//abs/path/**",
+				Pattern:  "",
+				Original: "Read(//abs/path/**)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - home path",
+			permission: "Read(~/notes/**)",
+			want: ToolPermission{
+				Tool:     "Read",
+				Command:  "~/notes/**",
+				Pattern:  "",
+				Original: "Read(~/notes/**)",
+			},
+			expectError: false,
+		},
+		{
+			name:       "Full syntax - whole MCP server",
+			permission: "mcp__github",
+			want: ToolPermission{
+				Tool:     "mcp__github",
+				Command:  "",
+				Pattern:  "",
+				Original: "mcp__github",
+			},
+			expectError: false,
+		},
+		{
+			name:        "Error - unbalanced parentheses",
+			permission:  "Bash(echo (a)",
 			want:        ToolPermission{},
 			expectError: true,
 		},
@@ -141,6 +252,47 @@ func TestParseToolPermission(t *testing.T) {
 	}
 }
 
+func TestParseToolPermission_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		permission string
+		wantPos    int
+	}{
+		{"Bash(git log", 4},
+		{"Bash(echo (a)", 4},
+		{"Bash(echo (a", 10},
+		{"(git log)", 0},
+		{"Bash()", 5},
+		{"Bash(:*)", 5},
+		{"WebFetch(domain:)", 16},
+		{"Bash(git log))", 13},
+		{"Bash git", 5},
+		{"Ba$h", 2},
+		{"mcp__", 5},
+		{"mcp____tool", 5},
+		{"mcp__github__", 13},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			_, err := ParseToolPermission(tt.permission)
+			var syntaxErr *PermissionSyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Expected a PermissionSyntaxError, got %v", err)
+			}
+			if syntaxErr.Pos != tt.wantPos {
+				t.Errorf("Pos = %d, want %d (%v)", syntaxErr.Pos, tt.wantPos, err)
+			}
+		})
+	}
+
+	// Errors keep their position through ParseToolPermissions
+	_, err := ParseToolPermissions([]string{"Read", "Edit(src/**"})
+	var syntaxErr *PermissionSyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Rule != "Edit(src/**" || syntaxErr.Pos != 4 {
+		t.Errorf("Expected the wrapped syntax error, got %v", err)
+	}
+}
+
 func TestParseToolPermissions(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -0,0 +1,476 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Decision is the outcome of evaluating a tool use against a Policy
+type Decision string
+
+const (
+	// DecisionAllow lets the tool run without asking
+	DecisionAllow Decision = "allow"
+	// DecisionDeny blocks the tool
+	DecisionDeny Decision = "deny"
+	// DecisionAsk requires confirmation before the tool runs
+	DecisionAsk Decision = "ask"
+)
+
+// isValidDecision checks if the decision is supported
+func isValidDecision(decision Decision) bool {
+	switch decision {
+	case DecisionAllow, DecisionDeny, DecisionAsk:
+		return true
+	default:
+		return false
+	}
+}
+
+// PolicyOptions configures a Policy
+type PolicyOptions struct {
+	// Allow, Deny and Ask are permission rules in the AllowedTools format, e.g. "Bash(git log:*)" or "Edit(src/**)"
+	Allow []string
+	Deny  []string
+	Ask   []string
+	// Default is the decision when no rule matches (default DecisionAsk)
+	Default Decision
+	// Match controls how file rules are resolved, usually with BaseDir set to the run's working directory
+	Match MatchOptions
+}
+
+// PolicyRule is a permission rule with the decision it leads to
+type PolicyRule struct {
+	Decision   Decision
+	Permission ToolPermission
+}
+
+// String returns the rule as written, e.g. "deny Bash(rm:*)"
+func (r PolicyRule) String() string {
+	return fmt.Sprintf("%s %s", r.Decision, r.Permission.Original)
+}
+
+// PolicyDecision is the result of Policy.Evaluate with an explanation
+type PolicyDecision struct {
+	Decision Decision
+	// Rule is the rule that decided, or nil when the default applied
+	Rule *PolicyRule
+	// Matches lists every rule that matched, in precedence order
+	Matches []PolicyRule
+	// Reason explains the decision
+	Reason string
+}
+
+// Policy evaluates tool uses against allow, deny and ask rules
+// Deny rules take precedence over ask rules, which take precedence over allow rules
+// A Policy is immutable and safe for concurrent use
+type Policy struct {
+	rules        []PolicyRule // in precedence order: deny, ask, allow
+	defaultValue Decision
+	match        MatchOptions
+}
+
+// NewPolicy parses the rules in opts into a Policy
+func NewPolicy(opts PolicyOptions) (*Policy, error) {
+	if opts.Default == "" {
+		opts.Default = DecisionAsk
+	}
+	if !isValidDecision(opts.Default) {
+		return nil, NewValidationError("Invalid default decision", "Default", opts.Default)
+	}
+
+	p := &Policy{defaultValue: opts.Default, match: opts.Match}
+	for _, group := range []struct {
+		decision Decision
+		field    string
+		rules    []string
+	}{
+		{DecisionDeny, "Deny", opts.Deny},
+		{DecisionAsk, "Ask", opts.Ask},
+		{DecisionAllow, "Allow", opts.Allow},
+	} {
+		parsed, err := ParseToolPermissions(group.rules)
+		if err != nil {
+			return nil, NewValidationError(err.Error(), group.field, group.rules)
+		}
+		for _, permission := range parsed {
+			p.rules = append(p.rules, PolicyRule{Decision: group.decision, Permission: permission})
+		}
+	}
+	return p, nil
+}
+
+// PolicyFromRunOptions builds a Policy from AllowedTools and DisallowedTools, resolving file rules against WorkingDir
+func PolicyFromRunOptions(opts *RunOptions) (*Policy, error) {
+	if opts == nil {
+		return NewPolicy(PolicyOptions{})
+	}
+	return NewPolicy(PolicyOptions{
+		Allow: opts.AllowedTools,
+		Deny:  opts.DisallowedTools,
+		Match: MatchOptions{BaseDir: opts.WorkingDir},
+	})
+}
+
+// Rules returns the policy's rules in precedence order
+func (p *Policy) Rules() []PolicyRule {
+	return append([]PolicyRule(nil), p.rules...)
+}
+
+// Evaluate decides whether a tool use is allowed
+// input is the tool's input as sent by the model, e.g. {"command": "git log"} for Bash
+func (p *Policy) Evaluate(toolName string, input map[string]interface{}) PolicyDecision {
+	var decision PolicyDecision
+	for _, rule := range p.rules {
+		if p.ruleMatches(rule, toolName, input) {
+			decision.Matches = append(decision.Matches, rule)
+		}
+	}
+
+	if len(decision.Matches) == 0 {
+		decision.Decision = p.defaultValue
+		decision.Reason = fmt.Sprintf("no rule matches %s; default is %s", toolName, p.defaultValue)
+		return decision
+	}
+
+	// Rules are kept in precedence order, so the first match decides
+	winner := decision.Matches[0]
+	decision.Decision = winner.Decision
+	decision.Rule = &winner
+	decision.Reason = fmt.Sprintf("%s by rule %q", pastTense(winner.Decision), winner.Permission.Original)
+	if overridden := len(decision.Matches) - 1; overridden > 0 {
+		decision.Reason += fmt.Sprintf(" (overrides %d lower-precedence rule(s))", overridden)
+	}
+	return decision
+}
+
+// EvaluateToolUse decides on a tool_use content block
+func (p *Policy) EvaluateToolUse(block ContentBlock) PolicyDecision {
+	var input map[string]interface{}
+	if len(block.Input) > 0 {
+		_ = json.Unmarshal(block.Input, &input)
+	}
+	return p.Evaluate(block.Name, input)
+}
+
+// pastTense describes a decision in reasons
+func pastTense(decision Decision) string {
+	switch decision {
+	case DecisionAllow:
+		return "allowed"
+	case DecisionDeny:
+		return "denied"
+	default:
+		return "requires confirmation"
+	}
+}
+
+// editTools and readTools are the tools covered by Edit and Read rules
+var (
+	editTools = map[string]bool{"Edit": true, "MultiEdit": true, "Write": true, "NotebookEdit": true}
+	readTools = map[string]bool{"Read": true, "Glob": true, "Grep": true, "LS": true, "NotebookRead": true}
+)
+
+// ruleMatches reports whether a rule applies to a tool use
+func (p *Policy) ruleMatches(rule PolicyRule, toolName string, input map[string]interface{}) bool {
+	perm := rule.Permission
+	if !ruleCoversTool(perm.Tool, toolName) {
+		return false
+	}
+	if perm.IsLegacyFormat() {
+		return true
+	}
+
+	switch {
+	case toolName == "Bash":
+		return bashRuleMatches(perm, inputString(input, "command"), rule.Decision)
+	case toolName == "WebFetch":
+		return domainRuleMatches(perm, inputString(input, "url"))
+	case editTools[toolName] || readTools[toolName]:
+		target, ok := filePathInput(toolName, input)
+		return ok && p.fileRuleMatches(perm, target)
+	}
+	// Tools without a known input shape only match rules without a specifier
+	return false
+}
+
+// ruleCoversTool reports whether a rule's tool name covers a tool
+// Edit rules cover every editing tool and Read rules every reading tool;
+// "mcp__server" and "mcp__server__*" cover all tools of an MCP server
+func ruleCoversTool(ruleTool, toolName string) bool {
+	switch {
+	case ruleTool == toolName:
+		return true
+	case ruleTool == "Edit":
+		return editTools[toolName]
+	case ruleTool == "Read":
+		return readTools[toolName]
+	case strings.HasPrefix(ruleTool, "mcp__") && strings.HasPrefix(toolName, "mcp__"):
+		server := strings.TrimSuffix(strings.TrimSuffix(ruleTool, "*"), "__")
+		return strings.Count(server, "__") == 1 && strings.HasPrefix(toolName, server+"__")
+	}
+	return false
+}
+
+// inputString returns a string field of a tool input
+func inputString(input map[string]interface{}, key string) string {
+	s, _ := input[key].(string)
+	return s
+}
+
+// filePathInput returns the path a file tool operates on
+func filePathInput(toolName string, input map[string]interface{}) (string, bool) {
+	switch toolName {
+	case "NotebookEdit", "NotebookRead":
+		if p := inputString(input, "notebook_path"); p != "" {
+			return p, true
+		}
+	case "Glob":
+		// The searched pattern is checked as a path below the search directory
+		pattern := inputString(input, "pattern")
+		if dir := inputString(input, "path"); dir != "" {
+			pattern = path.Join(dir, pattern)
+		}
+		return pattern, pattern != ""
+	case "Grep", "LS":
+		if p := inputString(input, "path"); p != "" {
+			return p, true
+		}
+		return ".", true
+	}
+	p := inputString(input, "file_path")
+	return p, p != ""
+}
+
+// fileRuleMatches matches a file path against a rule's path glob
+func (p *Policy) fileRuleMatches(perm ToolPermission, target string) bool {
+	return perm.MatchesPath(target, p.match)
+}
+
+// bashRuleMatches matches a shell command against a Bash rule
+// "Bash(npm test)" matches exactly and "Bash(git log:*)" matches the command with any arguments
+// Compound commands are split on shell operators and subshells: allow rules must match every part,
+// while deny and ask rules match if any part matches, so "git log && rm -rf /" is not allowed by "Bash(git log:*)"
+// Commands run by $(...), backticks or process substitution are checked against deny and ask rules,
+// but a command containing them never matches an allow rule
+func bashRuleMatches(perm ToolPermission, command string, decision Decision) bool {
+	commands := splitShellCommand(command)
+	if len(commands) == 0 {
+		return false
+	}
+	for _, cmd := range commands {
+		if decision != DecisionAllow {
+			if bashRestrictiveMatches(perm, cmd.words) {
+				return true
+			}
+			continue
+		}
+		if cmd.substitutes || !bashPartMatches(perm, cmd.words) {
+			return false
+		}
+	}
+	return decision == DecisionAllow
+}
+
+// commandWrappers run the command given in their arguments
+var commandWrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "nohup": true, "time": true, "nice": true, "ionice": true,
+	"exec": true, "command": true, "builtin": true, "xargs": true, "timeout": true, "stdbuf": true, "watch": true,
+}
+
+// bashRestrictiveMatches matches a deny or ask rule against a simple command
+// The command is also matched by program name, so "/bin/rm" matches "Bash(rm:*)", and behind wrappers:
+// every argument of "sudo -u root rm -rf /" is tried as the start of the command, as wrapper options vary
+func bashRestrictiveMatches(perm ToolPermission, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	if bashPartMatches(perm, words) || bashPartMatches(perm, withProgramName(words)) {
+		return true
+	}
+	if !commandWrappers[path.Base(words[0])] {
+		return false
+	}
+	for i := 1; i < len(words); i++ {
+		if bashPartMatches(perm, words[i:]) || bashPartMatches(perm, withProgramName(words[i:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// withProgramName replaces a program path such as "/bin/rm" with its name
+func withProgramName(words []string) []string {
+	if !strings.Contains(words[0], "/") {
+		return words
+	}
+	return append([]string{path.Base(words[0])}, words[1:]...)
+}
+
+// bashPartMatches matches the words of a simple command
+func bashPartMatches(perm ToolPermission, words []string) bool {
+	command := strings.Join(words, " ")
+	prefix := strings.Join(strings.Fields(perm.Command), " ")
+	// The prefix must end at a word boundary, so "Bash(rm:*)" does not match "rmdir"
+	if command != prefix && !strings.HasPrefix(command, prefix+" ") {
+		return false
+	}
+	switch perm.Pattern {
+	case "":
+		return command == prefix
+	case "*":
+		return true
+	}
+	return MatchGlob(perm.Pattern, strings.TrimSpace(strings.TrimPrefix(command, prefix)))
+}
+
+// shellCommand is a simple command split from a command line
+type shellCommand struct {
+	// words excludes grouping braces and leading variable assignments
+	words []string
+	// substitutes is set when the command contains $(...), backticks or <(...), whose commands are listed separately
+	substitutes bool
+}
+
+// splitShellCommand splits a command line into simple commands
+// It splits on ;, &, |, &&, ||, newlines and subshell parentheses outside quotes and redirections,
+// and appends the commands run by command and process substitutions
+func splitShellCommand(command string) []shellCommand {
+	var commands, nested []shellCommand
+	var current strings.Builder
+	var quote byte
+	substitutes := false
+	flush := func() {
+		if words := commandWords(current.String()); len(words) > 0 {
+			commands = append(commands, shellCommand{words: words, substitutes: substitutes})
+		}
+		current.Reset()
+		substitutes = false
+	}
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		// Substitutions run inside double quotes too, but not inside single quotes
+		if quote != '\'' {
+			if body, end, ok := shellSubstitution(command, i); ok {
+				nested = append(nested, splitShellCommand(body)...)
+				substitutes = true
+				current.WriteString(command[i:end])
+				i = end - 1
+				continue
+			}
+		}
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' && i+1 < len(command) {
+				current.WriteByte(c)
+				i++
+				c = command[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\' && i+1 < len(command):
+			current.WriteByte(c)
+			i++
+			c = command[i]
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '&' && (i > 0 && command[i-1] == '>' || i+1 < len(command) && command[i+1] == '>'):
+			// Redirections such as 2>&1 and &> are not operators
+		case c == ';' || c == '&' || c == '|' || c == '\n' || c == '(' || c == ')':
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return append(commands, nested...)
+}
+
+// shellSubstitution returns the body of a $(...), <(...), >(...) or backtick substitution starting at i
+// An unterminated substitution extends to the end of the command
+func shellSubstitution(command string, i int) (body string, end int, ok bool) {
+	if command[i] == '`' {
+		for j := i + 1; j < len(command); j++ {
+			if command[j] == '\\' {
+				j++
+			} else if command[j] == '`' {
+				return command[i+1 : j], j + 1, true
+			}
+		}
+		return command[i+1:], len(command), true
+	}
+	if !strings.ContainsRune("$<>", rune(command[i])) || i+1 >= len(command) || command[i+1] != '(' {
+		return "", 0, false
+	}
+
+	depth := 1
+	var quote byte
+	for j := i + 2; j < len(command); j++ {
+		c := command[j]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				j++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			j++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return command[i+2 : j], j + 1, true
+			}
+		}
+	}
+	return command[i+2:], len(command), true
+}
+
+// commandWords splits a simple command into words without grouping braces, "!" and leading variable assignments
+func commandWords(command string) []string {
+	words := strings.Fields(command)
+	for len(words) > 0 && (words[0] == "{" || words[0] == "!" || isVariableAssignment(words[0])) {
+		words = words[1:]
+	}
+	for len(words) > 0 && words[len(words)-1] == "}" {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// isVariableAssignment reports whether a word is a shell assignment such as FOO=1
+func isVariableAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// domainRuleMatches matches a URL against a WebFetch rule such as "WebFetch(domain:example.com)"
+// The domain may be a glob like "*.example.com"
+func domainRuleMatches(perm ToolPermission, rawURL string) bool {
+	if perm.Command != "domain" || perm.Pattern == "" {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	matched, err := path.Match(strings.ToLower(perm.Pattern), host)
+	return err == nil && matched
+}
@@ -3,6 +3,8 @@ package claude
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -102,16 +104,16 @@ func TestQueryOptionsToRunOptions(t *testing.T) {
 	if queryOpts.Model != runOpts.Model {
 		t.Errorf("Model mismatch: got %s, want %s", runOpts.Model, queryOpts.Model)
 	}
+	if queryOpts.WorkingDir != runOpts.WorkingDir {
+		t.Errorf("WorkingDir mismatch: got %s, want %s", runOpts.WorkingDir, queryOpts.WorkingDir)
+	}
 
 	// Test permission mode mapping
-	if !contains(runOpts.AllowedTools, "Write") {
-		t.Error("AllowedTools should contain Write")
-	}
-	if !contains(runOpts.AllowedTools, "Edit") {
-		t.Error("AllowedTools should contain Edit")
+	if runOpts.PermissionMode != PermissionModeAcceptEdits {
+		t.Errorf("PermissionMode mismatch: got %s, want %s", runOpts.PermissionMode, PermissionModeAcceptEdits)
 	}
-	if !contains(runOpts.AllowedTools, "MultiEdit") {
-		t.Error("AllowedTools should contain MultiEdit")
+	if len(runOpts.AllowedTools) != 2 {
+		t.Errorf("AllowedTools should not be extended by permission mode, got %v", runOpts.AllowedTools)
 	}
 }
 
@@ -120,47 +122,160 @@ func TestQueryOptionsPermissionModes(t *testing.T) {
 
 	tests := []struct {
 		name           string
-		permissionMode string
-		expectedResult func(*RunOptions) bool
+		permissionMode PermissionMode
+		expectedArgs   []string
 	}{
-		{
-			name:           "acceptEdits mode",
-			permissionMode: "acceptEdits",
-			expectedResult: func(opts *RunOptions) bool {
-				return contains(opts.AllowedTools, "Write") &&
-					contains(opts.AllowedTools, "Edit") &&
-					contains(opts.AllowedTools, "MultiEdit")
-			},
-		},
-		{
-			name:           "rejectAll mode",
-			permissionMode: "rejectAll",
-			expectedResult: func(opts *RunOptions) bool {
-				return contains(opts.DisallowedTools, "*")
-			},
-		},
-		{
-			name:           "ask mode (default)",
-			permissionMode: "ask",
-			expectedResult: func(opts *RunOptions) bool {
-				// Should not add any special tools
-				return len(opts.DisallowedTools) == 0
-			},
-		},
+		{"default mode", PermissionModeDefault, []string{"--permission-mode", "default"}},
+		{"acceptEdits mode", PermissionModeAcceptEdits, []string{"--permission-mode", "acceptEdits"}},
+		{"plan mode", PermissionModePlan, []string{"--permission-mode", "plan"}},
+		{"bypassPermissions mode", PermissionModeBypassPermissions, []string{"--permission-mode", "bypassPermissions"}},
+		{"legacy ask mode", "ask", []string{"--permission-mode", "default"}},
+		{"unset mode", "", nil},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			queryOpts := QueryOptions{
+			runOpts := client.queryOptionsToRunOptions(QueryOptions{
 				PermissionMode: tt.permissionMode,
+			})
+
+			if err := PreprocessOptions(runOpts); err != nil {
+				t.Fatalf("Unexpected validation error: %v", err)
+			}
+			if len(runOpts.AllowedTools) != 0 || len(runOpts.DisallowedTools) != 0 {
+				t.Errorf("Permission mode should not change tool lists, got allowed=%v disallowed=%v",
+					runOpts.AllowedTools, runOpts.DisallowedTools)
 			}
 
-			runOpts := client.queryOptionsToRunOptions(queryOpts)
-			if !tt.expectedResult(runOpts) {
-				t.Errorf("Permission mode %s test failed", tt.permissionMode)
+			args := BuildArgs("test", runOpts)
+			if tt.expectedArgs == nil {
+				if contains(args, "--permission-mode") {
+					t.Errorf("Expected no --permission-mode flag, got %v", args)
+				}
+				return
+			}
+			if !containsSequence(args, tt.expectedArgs) {
+				t.Errorf("Expected %v in args, got %v", tt.expectedArgs, args)
 			}
 		})
 	}
+
+	// Unknown modes are rejected during validation
+	runOpts := client.queryOptionsToRunOptions(QueryOptions{PermissionMode: "rejectAll"})
+	if err := PreprocessOptions(runOpts); err == nil {
+		t.Error("Expected validation error for unknown permission mode")
+	}
+}
+
+func TestQueryOptions_PythonJSONRoundTrip(t *testing.T) {
+	// Options document as produced by json.dumps(asdict(ClaudeCodeOptions(...))) in Python
+	pythonDoc := `{
+		"allowed_tools": ["Read", "Write"],
+		"max_thinking_tokens": 8000,
+		"system_prompt": "You are helpful",
+		"append_system_prompt": "Be brief",
+		"mcp_servers": {
+			"filesystem": {"type": "stdio", "command": "npx", "args": ["-y", "@mcp/fs"], "env": {"ROOT": "/tmp"}},
+			"remote": {"type": "http", "url": "https://mcp.example.com", "headers": {"Authorization": "Bearer x"}}
+		},
+		"permission_mode": "plan",
+		"continue_conversation": true,
+		"resume": "session-123",
+		"max_turns": 4,
+		"disallowed_tools": ["Bash"],
+		"model": "claude-sonnet-4-20250514",
+		"permission_prompt_tool_name": "mcp__auth__prompt",
+		"cwd": "/work",
+		"settings": "/work/.claude/settings.json",
+		"add_dirs": ["/data", "/shared"],
+		"env": {"FOO": "bar"},
+		"extra_args": {"debug": null, "output-style": "concise"}
+	}`
+
+	var opts QueryOptions
+	if err := json.Unmarshal([]byte(pythonDoc), &opts); err != nil {
+		t.Fatalf("Failed to decode Python options: %v", err)
+	}
+
+	if opts.MaxThinkingTokens != 8000 || opts.AppendSystemPrompt != "Be brief" || opts.PermissionMode != PermissionModePlan {
+		t.Errorf("Scalar fields not decoded: %+v", opts)
+	}
+	if !opts.Continue || opts.ResumeID != "session-123" || opts.WorkingDir != "/work" {
+		t.Errorf("Session fields not decoded: %+v", opts)
+	}
+	if opts.PermissionPromptToolName != "mcp__auth__prompt" || opts.Settings != "/work/.claude/settings.json" {
+		t.Errorf("Permission/settings fields not decoded: %+v", opts)
+	}
+	if len(opts.AddDirs) != 2 || opts.Env["FOO"] != "bar" || len(opts.DisallowedTools) != 1 {
+		t.Errorf("Collection fields not decoded: %+v", opts)
+	}
+	if opts.MCPServers["filesystem"].Command != "npx" || opts.MCPServers["remote"].URL != "https://mcp.example.com" {
+		t.Errorf("MCP servers not decoded: %+v", opts.MCPServers)
+	}
+	if v, ok := opts.ExtraArgs["debug"]; !ok || v != nil {
+		t.Errorf("Expected extra_args.debug to be a bare flag, got %v", v)
+	}
+	if v := opts.ExtraArgs["output-style"]; v == nil || *v != "concise" {
+		t.Errorf("Expected extra_args.output-style to be concise, got %v", v)
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatalf("Failed to encode options: %v", err)
+	}
+
+	var want, got map[string]interface{}
+	if err := json.Unmarshal([]byte(pythonDoc), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Round trip mismatch:\nwant %v\ngot  %v", want, got)
+	}
+
+	// Every Python field must reach the CLI
+	args := BuildArgs("test", toRunOptions(opts))
+	for _, expected := range [][]string{
+		{"--append-system-prompt", "Be brief"},
+		{"--disallowedTools", "Bash"},
+		{"--permission-prompt-tool", "mcp__auth__prompt"},
+		{"--permission-mode", "plan"},
+		{"--resume", "session-123"},
+		{"--add-dir", "/data", "--add-dir", "/shared"},
+		{"--settings", "/work/.claude/settings.json"},
+		{"--max-thinking-tokens", "8000"},
+		{"--debug", "--output-style", "concise"},
+	} {
+		if !containsSequence(args, expected) {
+			t.Errorf("Expected %v in args, got %v", expected, args)
+		}
+	}
+	if !contains(args, "--mcp-config") {
+		t.Errorf("Expected inline --mcp-config in args, got %v", args)
+	}
+}
+
+func TestQueryOptions_MCPServersPath(t *testing.T) {
+	var opts QueryOptions
+	if err := json.Unmarshal([]byte(`{"mcp_servers": "/etc/mcp.json", "resume_id": "legacy", "continue": true}`), &opts); err != nil {
+		t.Fatalf("Failed to decode options: %v", err)
+	}
+	if opts.MCPConfigPath != "/etc/mcp.json" || len(opts.MCPServers) != 0 {
+		t.Errorf("Expected mcp_servers path to populate MCPConfigPath, got %+v", opts)
+	}
+	if opts.ResumeID != "legacy" || !opts.Continue {
+		t.Errorf("Expected legacy keys to be accepted, got %+v", opts)
+	}
+
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatalf("Failed to encode options: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"mcp_servers":"/etc/mcp.json"`) {
+		t.Errorf("Expected mcp_servers path in JSON, got %s", encoded)
+	}
 }
 
 func TestMessage_ContentFieldPopulation(t *testing.T) {
@@ -190,6 +305,21 @@ func TestMessage_ContentFieldPopulation(t *testing.T) {
 	}
 }
 
+// toRunOptions converts QueryOptions the same way Query and QuerySync do
+func toRunOptions(opts QueryOptions) *RunOptions {
+	return (&ClaudeClient{BinPath: "claude"}).queryOptionsToRunOptions(opts)
+}
+
+// containsSequence checks if args contains seq as a contiguous run
+func containsSequence(args []string, seq []string) bool {
+	for i := 0; i+len(seq) <= len(args); i++ {
+		if reflect.DeepEqual(args[i:i+len(seq)], seq) {
+			return true
+		}
+	}
+	return false
+}
+
 // Helper function to check if slice contains string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,246 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions configures a RateLimiter
+type RateLimitOptions struct {
+	// RequestsPerMinute is the sustained rate of process launches
+	RequestsPerMinute float64
+	// Burst is the number of launches allowed back to back (default 1)
+	Burst int
+	// MinRequestsPerMinute is the floor the rate is reduced to after rate limit errors
+	// (default 10% of RequestsPerMinute)
+	MinRequestsPerMinute float64
+	// StateFile coordinates the limiter across processes on the same host (optional)
+	// All processes sharing the file share one token bucket
+	StateFile string
+	// StaleLockTimeout is how old a lock file may get before it is considered abandoned (default 10s)
+	StaleLockTimeout time.Duration
+}
+
+// RateLimiter is a token bucket that gates Claude process launches
+// It slows down when rate limit errors are observed and recovers on success
+// It is safe for concurrent use by multiple goroutines
+type RateLimiter struct {
+	opts    RateLimitOptions
+	mu      sync.Mutex
+	state   limiterState
+	lockTTL time.Duration
+	now     func() time.Time
+}
+
+// limiterState is the token bucket state, persisted to StateFile when configured
+type limiterState struct {
+	Tokens       float64   `json:"tokens"`
+	Last         time.Time `json:"last"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	// RatePerMinute is the current adaptive rate
+	RatePerMinute float64 `json:"rate_per_minute"`
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter(opts RateLimitOptions) (*RateLimiter, error) {
+	if opts.RequestsPerMinute <= 0 {
+		return nil, NewValidationError("RequestsPerMinute must be positive", "RequestsPerMinute", opts.RequestsPerMinute)
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 1
+	}
+	if opts.MinRequestsPerMinute <= 0 || opts.MinRequestsPerMinute > opts.RequestsPerMinute {
+		opts.MinRequestsPerMinute = opts.RequestsPerMinute / 10
+	}
+
+	lockTTL := opts.StaleLockTimeout
+	if lockTTL <= 0 {
+		lockTTL = 10 * time.Second
+	}
+
+	return &RateLimiter{
+		opts:    opts,
+		state:   limiterState{Tokens: float64(opts.Burst), RatePerMinute: opts.RequestsPerMinute},
+		lockTTL: lockTTL,
+		now:     time.Now,
+	}, nil
+}
+
+// WithRateLimiter gates every process launch of the client through limiter
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *ClaudeClient) {
+		c.RateLimiter = limiter
+	}
+}
+
+// Wait blocks until a launch is allowed or ctx is done
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		var wait time.Duration
+		err := rl.update(ctx, func(s *limiterState, now time.Time) {
+			rl.refill(s, now)
+
+			if now.Before(s.BlockedUntil) {
+				wait = s.BlockedUntil.Sub(now)
+				return
+			}
+			if s.Tokens >= 1 {
+				s.Tokens--
+				wait = 0
+				return
+			}
+			wait = time.Duration((1 - s.Tokens) / (s.RatePerMinute / 60) * float64(time.Second))
+		})
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Observe adapts the limiter to the outcome of a launch
+// A rate limit error pauses all launches for its retry delay and halves the rate;
+// each success raises the rate back towards RequestsPerMinute
+func (rl *RateLimiter) Observe(err error) {
+	var claudeErr *ClaudeError
+	isRateLimit := errors.As(err, &claudeErr) && claudeErr.Type == ErrorRateLimit
+	if err != nil && !isRateLimit {
+		return
+	}
+
+	_ = rl.update(context.Background(), func(s *limiterState, now time.Time) {
+		rl.refill(s, now)
+
+		if !isRateLimit {
+			s.RatePerMinute = math.Min(s.RatePerMinute+rl.opts.RequestsPerMinute/10, rl.opts.RequestsPerMinute)
+			return
+		}
+
+		s.RatePerMinute = math.Max(s.RatePerMinute/2, rl.opts.MinRequestsPerMinute)
+		s.Tokens = 0
+		if delay := time.Duration(claudeErr.RetryDelay()) * time.Second; delay > 0 {
+			if until := now.Add(delay); until.After(s.BlockedUntil) {
+				s.BlockedUntil = until
+			}
+		}
+	})
+}
+
+// BlockUntil pauses all launches until t
+func (rl *RateLimiter) BlockUntil(t time.Time) {
+	_ = rl.update(context.Background(), func(s *limiterState, now time.Time) {
+		if t.After(s.BlockedUntil) {
+			s.BlockedUntil = t
+		}
+	})
+}
+
+// CurrentRate returns the current adaptive rate in requests per minute
+func (rl *RateLimiter) CurrentRate() float64 {
+	var rate float64
+	_ = rl.update(context.Background(), func(s *limiterState, now time.Time) {
+		rate = s.RatePerMinute
+	})
+	return rate
+}
+
+// refill adds the tokens accrued since the last update
+func (rl *RateLimiter) refill(s *limiterState, now time.Time) {
+	if s.RatePerMinute <= 0 {
+		s.RatePerMinute = rl.opts.RequestsPerMinute
+	}
+	if !s.Last.IsZero() && now.After(s.Last) {
+		s.Tokens += now.Sub(s.Last).Seconds() * s.RatePerMinute / 60
+	}
+	if burst := float64(rl.opts.Burst); s.Tokens > burst {
+		s.Tokens = burst
+	}
+	s.Last = now
+}
+
+// update applies fn to the limiter state, holding the cross-process lock when a state file is used
+// Waiting for the lock ends when ctx is done
+func (rl *RateLimiter) update(ctx context.Context, fn func(s *limiterState, now time.Time)) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.opts.StateFile == "" {
+		fn(&rl.state, rl.now())
+		return nil
+	}
+
+	unlock, err := rl.lockStateFile(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state := limiterState{Tokens: float64(rl.opts.Burst), RatePerMinute: rl.opts.RequestsPerMinute}
+	if data, err := os.ReadFile(rl.opts.StateFile); err == nil {
+		// A corrupt state file is replaced by a fresh bucket
+		_ = json.Unmarshal(data, &state)
+	}
+
+	fn(&state, rl.now())
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode rate limiter state: %w", err)
+	}
+	tmp := rl.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write rate limiter state: %w", err)
+	}
+	if err := os.Rename(tmp, rl.opts.StateFile); err != nil {
+		return fmt.Errorf("failed to write rate limiter state: %w", err)
+	}
+	return nil
+}
+
+// lockStateFile acquires an exclusive lock file next to the state file
+// Lock files older than the stale timeout are assumed to belong to a crashed process
+func (rl *RateLimiter) lockStateFile(ctx context.Context) (func(), error) {
+	lockPath := rl.opts.StateFile + ".lock"
+	deadline := time.Now().Add(rl.lockTTL * 2)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock rate limiter state: %w", err)
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > rl.lockTTL {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for rate limiter lock %s", lockPath)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, opts RateLimitOptions) *RateLimiter {
+	t.Helper()
+	limiter, err := NewRateLimiter(opts)
+	if err != nil {
+		t.Fatalf("NewRateLimiter failed: %v", err)
+	}
+	return limiter
+}
+
+func TestNewRateLimiter_Validation(t *testing.T) {
+	if _, err := NewRateLimiter(RateLimitOptions{}); err == nil {
+		t.Error("Expected error for zero RequestsPerMinute")
+	}
+
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 100})
+	if limiter.opts.Burst != 1 {
+		t.Errorf("Expected default burst 1, got %d", limiter.opts.Burst)
+	}
+	if limiter.opts.MinRequestsPerMinute != 10 {
+		t.Errorf("Expected default minimum rate 10, got %v", limiter.opts.MinRequestsPerMinute)
+	}
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	// 1200 per minute is one token every 50ms
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 1200, Burst: 2})
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	// Two launches come from the burst, the other two wait for refills
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected launches beyond the burst to wait, took %v", elapsed)
+	}
+
+	// Concurrent callers never exceed the bucket
+	var wg sync.WaitGroup
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait(ctx)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected concurrent launches to be spaced out, took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_WaitCanceled(t *testing.T) {
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 1})
+	limiter.Wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimiter_Observe(t *testing.T) {
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 6000, Burst: 5})
+
+	// Errors other than rate limits are ignored
+	limiter.Observe(NewClaudeError(ErrorNetwork, "connection reset"))
+	if rate := limiter.CurrentRate(); rate != 6000 {
+		t.Errorf("Expected rate to be unchanged, got %v", rate)
+	}
+
+	rateErr := &ClaudeError{Type: ErrorRateLimit, Details: map[string]interface{}{"retry_after": 1}}
+	limiter.Observe(rateErr)
+	if rate := limiter.CurrentRate(); rate != 3000 {
+		t.Errorf("Expected rate to be halved, got %v", rate)
+	}
+
+	// Launches are paused until retry_after has passed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Error("Expected Wait to block after a rate limit error")
+	}
+
+	// Successes recover the rate additively up to the configured rate
+	limiter.Observe(nil)
+	if rate := limiter.CurrentRate(); rate != 3600 {
+		t.Errorf("Expected rate to recover by 10%%, got %v", rate)
+	}
+	for i := 0; i < 10; i++ {
+		limiter.Observe(nil)
+	}
+	if rate := limiter.CurrentRate(); rate != 6000 {
+		t.Errorf("Expected rate to be capped at RequestsPerMinute, got %v", rate)
+	}
+
+	// The rate never drops below the minimum
+	for i := 0; i < 20; i++ {
+		limiter.Observe(&ClaudeError{Type: ErrorRateLimit})
+	}
+	if rate := limiter.CurrentRate(); rate != 600 {
+		t.Errorf("Expected rate floor of 600, got %v", rate)
+	}
+}
+
+func TestRateLimiter_StateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "ratelimit.json")
+	opts := RateLimitOptions{RequestsPerMinute: 1, StateFile: stateFile}
+
+	// Two limiters stand in for two processes sharing the state file
+	first := newTestLimiter(t, opts)
+	second := newTestLimiter(t, opts)
+
+	if err := first.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := second.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected shared bucket to be empty, got %v", err)
+	}
+
+	// Pauses are shared as well
+	first.Observe(&ClaudeError{Type: ErrorRateLimit, Details: map[string]interface{}{"retry_after": 30}})
+	if rate := second.CurrentRate(); rate != 0.5 {
+		t.Errorf("Expected shared rate 0.5, got %v", rate)
+	}
+}
+
+func TestRateLimiter_StaleLock(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "ratelimit.json")
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 60, StateFile: stateFile, StaleLockTimeout: 10 * time.Millisecond})
+
+	// A lock left behind by a crashed process is taken over once stale
+	unlock, err := limiter.lockStateFile(context.Background())
+	if err != nil {
+		t.Fatalf("lockStateFile failed: %v", err)
+	}
+	_ = unlock
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Errorf("Expected stale lock to be removed, got %v", err)
+	}
+}
+
+func TestRateLimiter_LockWaitCanceled(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "ratelimit.json")
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 60, StateFile: stateFile, StaleLockTimeout: time.Minute})
+
+	// Another process holds the lock; the caller's context bounds the wait for it
+	unlock, err := limiter.lockStateFile(context.Background())
+	if err != nil {
+		t.Fatalf("lockStateFile failed: %v", err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Wait to stop with its context, took %v", elapsed)
+	}
+}
+
+func TestRateLimiter_ObserveDecodedRetryAfter(t *testing.T) {
+	for _, retryAfter := range []interface{}{30, 29.5, json.Number("30")} {
+		limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 60})
+		limiter.Observe(&ClaudeError{Type: ErrorRateLimit, Details: map[string]interface{}{"retry_after": retryAfter}})
+
+		// The pause follows retry_after instead of the one minute default
+		limiter.mu.Lock()
+		pause := limiter.state.BlockedUntil.Sub(limiter.state.Last)
+		limiter.mu.Unlock()
+		if pause != 30*time.Second {
+			t.Errorf("retry_after %#v: expected a 30s pause, got %v", retryAfter, pause)
+		}
+	}
+}
+
+func TestRunPromptCtx_RateLimiter(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = mockExecCommandStderr("", "Error: rate limit exceeded, retry after 30 seconds", 1)
+
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 600, Burst: 2})
+	client := NewClient("claude", WithRateLimiter(limiter))
+
+	_, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{Format: JSONOutput})
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorRateLimit {
+		t.Fatalf("Expected rate limit error, got %v", err)
+	}
+
+	// The next launch waits for retry_after instead of hitting the CLI again
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.RunPromptCtx(ctx, "test", &RunOptions{Format: JSONOutput})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected launch to be held by the rate limiter, got %v", err)
+	}
+}
+
+func TestRunPromptCtx_RateLimiterWaitNotTimed(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecCommandStderr(`{"type":"result","result":"ok"}`, "", 0)
+
+	// One launch every 600ms; the second run waits longer than its Timeout before starting
+	limiter := newTestLimiter(t, RateLimitOptions{RequestsPerMinute: 100})
+	client := NewClient("claude", WithRateLimiter(limiter))
+	opts := &RunOptions{Format: JSONOutput, Timeout: 400 * time.Millisecond}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.RunPromptCtx(context.Background(), "test", opts); err != nil {
+			t.Fatalf("Run %d: expected the timeout to start after the rate limiter, got %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package claude
+
+import (
+	"context"
+)
+
+// DefaultContinuationPrompt is sent when a stream is resumed after a failure
+const DefaultContinuationPrompt = "Your previous response was interrupted. Continue from where you left off."
+
+// MessageSubtypeStreamResumed marks the point in a resilient stream where the session was resumed
+const MessageSubtypeStreamResumed = "stream_resumed"
+
+// ResumePolicy configures how StreamPromptWithResume recovers from mid-stream failures
+type ResumePolicy struct {
+	// RetryPolicy bounds the number of resumes and the delay between them (default DefaultRetryPolicy)
+	// The client's RetryBudget applies as well
+	RetryPolicy *RetryPolicy
+	// ContinuationPrompt is sent with --resume when relaunching (default DefaultContinuationPrompt)
+	ContinuationPrompt string
+}
+
+// DefaultResumePolicy returns a sensible default resume policy
+func DefaultResumePolicy() *ResumePolicy {
+	return &ResumePolicy{
+		RetryPolicy:        DefaultRetryPolicy(),
+		ContinuationPrompt: DefaultContinuationPrompt,
+	}
+}
+
+// StreamPromptWithResume streams a prompt like StreamPrompt, but when the stream fails with a
+// retryable ClaudeError it relaunches the CLI with --resume and the continuation prompt
+// Messages from every attempt are sent on the same channel; each resume is preceded by a
+// system message with subtype MessageSubtypeStreamResumed
+// If the stream fails before a session ID is known, the original prompt is retried from scratch
+func (c *ClaudeClient) StreamPromptWithResume(ctx context.Context, prompt string, opts *RunOptions, policy *ResumePolicy) (<-chan Message, <-chan error) {
+	messageCh := make(chan Message)
+	errCh := make(chan error, 1)
+
+	if opts == nil {
+		opts = c.DefaultOptions
+	}
+	if policy == nil {
+		policy = DefaultResumePolicy()
+	}
+	continuation := policy.ContinuationPrompt
+	if continuation == "" {
+		continuation = DefaultContinuationPrompt
+	}
+
+	go func() {
+		defer close(messageCh)
+		defer close(errCh)
+
+		runOpts := *opts
+		currentPrompt := prompt
+		sessionID := ""
+		var lastErr error
+
+		err := c.retry(ctx, policy.RetryPolicy, func(ctx context.Context, attempt int) error {
+			if attempt > 0 && sessionID != "" {
+				marker := Message{
+					Type:      "system",
+					Subtype:   MessageSubtypeStreamResumed,
+					SessionID: sessionID,
+					Metadata: map[string]interface{}{
+						"attempt": attempt,
+						"error":   lastErr.Error(),
+					},
+				}
+				select {
+				case messageCh <- marker:
+				case <-ctx.Done():
+					return &noRetryError{ctx.Err()}
+				}
+
+				runOpts.ResumeID = sessionID
+				runOpts.Continue = false
+				currentPrompt = continuation
+			}
+			// Without a session ID there is nothing to resume; the original prompt is retried
+
+			msgs, errs := c.StreamPrompt(ctx, currentPrompt, &runOpts)
+
+			for msg := range msgs {
+				// Track the latest session; resumed runs may report a new session ID
+				if msg.SessionID != "" {
+					sessionID = msg.SessionID
+				}
+				select {
+				case messageCh <- msg:
+				case <-ctx.Done():
+					return &noRetryError{ctx.Err()}
+				}
+			}
+
+			lastErr = <-errs
+			return lastErr
+		})
+		if err != nil {
+			errCh <- err
+		}
+	}()
+
+	return messageCh, errCh
+}
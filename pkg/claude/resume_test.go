@@ -0,0 +1,119 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectStream drains a message stream and returns the messages and final error
+func collectStream(messageCh <-chan Message, errCh <-chan error) ([]Message, error) {
+	var messages []Message
+	for msg := range messageCh {
+		messages = append(messages, msg)
+	}
+	return messages, <-errCh
+}
+
+func TestStreamPromptWithResume(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	firstRun := `{"type":"system","subtype":"init","session_id":"s1"}
+{"type":"assistant","message":{},"session_id":"s1"}
+`
+	resumedRun := `{"type":"assistant","message":{},"session_id":"s1"}
+{"type":"result","subtype":"success","result":"done","session_id":"s1"}
+`
+
+	var calls [][]string
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls = append(calls, arg)
+		if len(calls) == 1 {
+			return mockExecCommandStderr(firstRun, "network error: connection reset", 1)(ctx, name, arg...)
+		}
+		return mockExecCommandStderr(resumedRun, "", 0)(ctx, name, arg...)
+	}
+
+	client := NewClient("claude")
+	policy := &ResumePolicy{
+		RetryPolicy:        &RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+		ContinuationPrompt: "keep going",
+	}
+
+	messages, err := collectStream(client.StreamPromptWithResume(context.Background(), "do work", &RunOptions{}, policy))
+	if err != nil {
+		t.Fatalf("Expected resumed stream to succeed, got %v", err)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 launches, got %d", len(calls))
+	}
+	if calls[0][1] != "do work" {
+		t.Errorf("Expected first launch to use the original prompt, got %v", calls[0])
+	}
+	if calls[1][1] != "keep going" || !containsSequence(calls[1], []string{"--resume", "s1"}) {
+		t.Errorf("Expected resume launch with continuation prompt, got %v", calls[1])
+	}
+
+	var types []string
+	for _, msg := range messages {
+		types = append(types, msg.Type+"/"+msg.Subtype)
+	}
+	want := "system/init assistant/ system/stream_resumed assistant/ result/success"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("Expected messages %q, got %q", want, got)
+	}
+
+	marker := messages[2]
+	if marker.SessionID != "s1" || marker.Metadata["attempt"] != 1 {
+		t.Errorf("Unexpected marker: %+v", marker)
+	}
+}
+
+func TestStreamPromptWithResume_Failures(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	initOnly := `{"type":"system","subtype":"init","session_id":"s1"}
+`
+	fastRetries := &ResumePolicy{RetryPolicy: &RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}}
+
+	tests := []struct {
+		name          string
+		stderr        string
+		expectedCalls int
+		expectedType  ErrorType
+	}{
+		{"non-retryable error is returned", "Error: permission denied", 1, ErrorPermission},
+		{"retry budget is enforced", "network error: connection reset", 3, ErrorNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+				calls++
+				return mockExecCommandStderr(initOnly, tt.stderr, 1)(ctx, name, arg...)
+			}
+
+			client := NewClient("claude")
+			_, err := collectStream(client.StreamPromptWithResume(context.Background(), "do work", &RunOptions{}, fastRetries))
+
+			var claudeErr *ClaudeError
+			if !errors.As(err, &claudeErr) || claudeErr.Type != tt.expectedType {
+				t.Fatalf("Expected %v error, got %v", tt.expectedType, err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d launches, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy defines the retry behavior for failed requests
+type RetryPolicy struct {
+	MaxRetries    int           // Maximum number of retry attempts
+	BaseDelay     time.Duration // Base delay between retries
+	MaxDelay      time.Duration // Maximum delay between retries
+	BackoffFactor float64       // Exponential backoff factor
+	Jitter        bool          // Use full jitter: wait a random delay between zero and the backoff
+
+	// Rules override MaxRetries and delays for specific error types
+	Rules map[ErrorType]RetryRule
+	// OnRetry is called before sleeping for each retry (e.g. for logging)
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// RetryRule overrides a RetryPolicy for one error type
+type RetryRule struct {
+	MaxRetries int           // Maximum number of retries when the latest error has this type (0 disables retries)
+	BaseDelay  time.Duration // Base delay (default: the policy's BaseDelay)
+	MaxDelay   time.Duration // Maximum delay (default: the policy's MaxDelay)
+}
+
+// DefaultRetryPolicy returns a sensible default retry policy
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:    3,
+		BaseDelay:     100 * time.Millisecond,
+		MaxDelay:      5 * time.Second,
+		BackoffFactor: 2.0,
+		Jitter:        true,
+	}
+}
+
+// calculateBackoff calculates the delay for a given retry attempt
+func (rp *RetryPolicy) calculateBackoff(attempt int) time.Duration {
+	return rp.backoff(attempt, rp.BaseDelay, rp.MaxDelay)
+}
+
+// backoff calculates the exponential delay for a retry attempt with the given bounds
+func (rp *RetryPolicy) backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+
+	delay := float64(base) * math.Pow(rp.BackoffFactor, float64(attempt-1))
+
+	result := time.Duration(delay)
+	if result > max {
+		result = max
+	}
+
+	return result
+}
+
+// nextDelay decides whether to retry after err and how long to wait first
+// It returns a non-empty reason when the error must not be retried
+func (rp *RetryPolicy) nextDelay(attempt int, err error) (time.Duration, string) {
+	var claudeErr *ClaudeError
+	if !errors.As(err, &claudeErr) || !claudeErr.IsRetryable() {
+		return 0, "not retryable"
+	}
+
+	maxRetries, base, max := rp.MaxRetries, rp.BaseDelay, rp.MaxDelay
+	if rule, ok := rp.Rules[claudeErr.Type]; ok {
+		maxRetries = rule.MaxRetries
+		if rule.BaseDelay > 0 {
+			base = rule.BaseDelay
+		}
+		if rule.MaxDelay > 0 {
+			max = rule.MaxDelay
+		}
+	}
+	if attempt > maxRetries {
+		return 0, fmt.Sprintf("max retries (%d) exceeded", maxRetries)
+	}
+
+	delay := rp.backoff(attempt, base, max)
+	if rp.Jitter && delay > 0 {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+
+	// Never retry sooner than the CLI asked us to
+	if _, hinted := claudeErr.Details["retry_after"]; hinted || claudeErr.Type == ErrorRateLimit {
+		if retryAfter := time.Duration(claudeErr.RetryDelay()) * time.Second; retryAfter > delay {
+			delay = retryAfter
+		}
+	}
+
+	return delay, ""
+}
+
+// RetryError is returned when a request failed after one or more retries
+type RetryError struct {
+	// Attempts holds the error of every attempt in order
+	Attempts []error
+	// Reason explains why retrying stopped
+	Reason string
+	// Cause is the context error when the context was done while waiting to retry
+	Cause error
+}
+
+// Error implements the error interface
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s after %d attempts, last error: %v", e.Reason, len(e.Attempts), e.Last())
+}
+
+// Last returns the error of the final attempt
+func (e *RetryError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// Unwrap returns the last attempt's error so errors.As finds the final ClaudeError
+func (e *RetryError) Unwrap() error {
+	return e.Last()
+}
+
+// Is reports whether target matches Cause, so errors.Is finds context.Canceled or context.DeadlineExceeded
+func (e *RetryError) Is(target error) bool {
+	return e.Cause != nil && errors.Is(e.Cause, target)
+}
+
+// RetryBudget caps retries to a ratio of requests within a sliding window to prevent retry storms
+// It is safe for concurrent use by multiple goroutines
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+	window     time.Duration
+
+	mu       sync.Mutex
+	requests []time.Time
+	retries  []time.Time
+}
+
+// NewRetryBudget creates a budget allowing minRetries plus ratio retries per request in each window
+// For example NewRetryBudget(0.2, 10, time.Minute) allows 10 retries plus one for every 5 requests per minute
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	return &RetryBudget{ratio: ratio, minRetries: minRetries, window: window}
+}
+
+// WithRetryBudget shares budget across all retrying calls made with the client
+func WithRetryBudget(budget *RetryBudget) ClientOption {
+	return func(c *ClaudeClient) {
+		c.RetryBudget = budget
+	}
+}
+
+// recordRequest counts a new request towards the budget
+func (b *RetryBudget) recordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.prune(time.Now())
+	b.requests = append(b.requests, time.Now())
+}
+
+// tryRetry reserves a retry if the budget allows it
+func (b *RetryBudget) tryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.prune(now)
+	if float64(len(b.retries)) >= float64(b.minRetries)+b.ratio*float64(len(b.requests)) {
+		return false
+	}
+	b.retries = append(b.retries, now)
+	return true
+}
+
+// prune drops events older than the window
+func (b *RetryBudget) prune(now time.Time) {
+	cutoff := now.Add(-b.window)
+	drop := func(events []time.Time) []time.Time {
+		i := 0
+		for i < len(events) && events[i].Before(cutoff) {
+			i++
+		}
+		return events[i:]
+	}
+	b.requests = drop(b.requests)
+	b.retries = drop(b.retries)
+}
+
+// noRetryError marks an error that must be returned without retrying
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string { return e.err.Error() }
+
+// retry calls fn until it succeeds, fails with a non-retryable error or the policy gives up
+// fn receives the zero-based attempt number
+func (c *ClaudeClient) retry(ctx context.Context, policy *RetryPolicy, fn func(ctx context.Context, attempt int) error) (err error) {
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+	if c.RetryBudget != nil {
+		c.RetryBudget.recordRequest()
+	}
+
+	// Each attempt's run span is a child of the retry span
+	ctx, span := c.tracer().Start(ctx, SpanRetry, Attr("claude.retry.max_retries", policy.MaxRetries))
+	var attempts []error
+	defer func() {
+		// Failed attempts are collected; a successful one is not
+		attemptCount := len(attempts)
+		if err == nil {
+			attemptCount++
+		}
+		span.SetAttributes(Attr("claude.retry.attempts", attemptCount))
+		var retryErr *RetryError
+		if errors.As(err, &retryErr) {
+			span.SetAttributes(Attr("claude.retry.reason", retryErr.Reason))
+		}
+		endRunSpan(span, nil, err)
+	}()
+
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+
+		var reason string
+		var delay time.Duration
+		if stop, ok := err.(*noRetryError); ok {
+			err, reason = stop.err, "not retryable"
+		} else {
+			delay, reason = policy.nextDelay(attempt+1, err)
+		}
+		attempts = append(attempts, err)
+
+		if reason == "" && c.RetryBudget != nil && !c.RetryBudget.tryRetry() {
+			reason = "retry budget exhausted"
+		}
+		if reason != "" {
+			if len(attempts) == 1 && reason == "not retryable" {
+				return err // Don't wrap errors that were never retried
+			}
+			c.logRetry(ctx, len(attempts), err, 0, reason)
+			return &RetryError{Attempts: attempts, Reason: reason}
+		}
+
+		c.logRetry(ctx, attempt+1, err, delay, "")
+		if c.Metrics != nil {
+			c.Metrics.recordRetry()
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt+1, err, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+			// Continue with retry
+		case <-ctx.Done():
+			// Keep the attempts so far; the context error is still found by errors.Is
+			return &RetryError{Attempts: attempts, Reason: "canceled while waiting to retry", Cause: ctx.Err()}
+		}
+	}
+}
+
+// RunPromptWithRetry executes a prompt with intelligent retry logic for recoverable errors
+func (c *ClaudeClient) RunPromptWithRetry(prompt string, opts *RunOptions, retryPolicy *RetryPolicy) (*ClaudeResult, error) {
+	return c.RunPromptWithRetryCtx(context.Background(), prompt, opts, retryPolicy)
+}
+
+// RunPromptWithRetryCtx executes a prompt with context support and intelligent retry logic
+func (c *ClaudeClient) RunPromptWithRetryCtx(ctx context.Context, prompt string, opts *RunOptions, retryPolicy *RetryPolicy) (*ClaudeResult, error) {
+	var result *ClaudeResult
+	err := c.retry(ctx, retryPolicy, func(ctx context.Context, _ int) error {
+		var err error
+		result, err = c.RunPromptCtx(ctx, prompt, opts)
+		return err
+	})
+	if err != nil {
+		// result is the last attempt's partial result, if the CLI reported one
+		return result, err
+	}
+	return result, nil
+}
+
+// StreamPromptWithRetry streams a prompt, relaunching it from scratch on retryable errors
+// Retries only happen while no message has been delivered; once output has been streamed
+// the error is returned as is (see StreamPromptWithResume to continue interrupted sessions)
+func (c *ClaudeClient) StreamPromptWithRetry(ctx context.Context, prompt string, opts *RunOptions, retryPolicy *RetryPolicy) (<-chan Message, <-chan error) {
+	messageCh := make(chan Message)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(messageCh)
+		defer close(errCh)
+
+		err := c.retry(ctx, retryPolicy, func(ctx context.Context, _ int) error {
+			msgs, errs := c.StreamPrompt(ctx, prompt, opts)
+
+			delivered := false
+			for msg := range msgs {
+				select {
+				case messageCh <- msg:
+					delivered = true
+				case <-ctx.Done():
+					return &noRetryError{ctx.Err()}
+				}
+			}
+
+			err := <-errs
+			if err != nil && delivered {
+				return &noRetryError{err}
+			}
+			return err
+		})
+		if err != nil {
+			errCh <- err
+		}
+	}()
+
+	return messageCh, errCh
+}
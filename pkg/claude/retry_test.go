@@ -0,0 +1,257 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_nextDelay(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxRetries:    2,
+		BaseDelay:     100 * time.Millisecond,
+		MaxDelay:      time.Second,
+		BackoffFactor: 2.0,
+		Rules: map[ErrorType]RetryRule{
+			ErrorNetwork: {MaxRetries: 5, BaseDelay: 10 * time.Millisecond},
+			ErrorMCP:     {MaxRetries: 0},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		attempt    int
+		err        error
+		wantDelay  time.Duration
+		wantReason string
+	}{
+		{"policy backoff", 2, NewClaudeError(ErrorTimeout, "timed out"), 200 * time.Millisecond, ""},
+		{"policy max retries", 3, NewClaudeError(ErrorTimeout, "timed out"), 0, "max retries (2) exceeded"},
+		{"rule raises max retries", 4, NewClaudeError(ErrorNetwork, "reset"), 80 * time.Millisecond, ""},
+		{"rule disables retries", 1, NewClaudeError(ErrorMCP, "connection failed"), 0, "max retries (0) exceeded"},
+		{"retry_after is honored", 1, &ClaudeError{Type: ErrorRateLimit, Details: map[string]interface{}{"retry_after": 2}}, 2 * time.Second, ""},
+		{"non-retryable type", 1, NewClaudeError(ErrorAuthentication, "bad key"), 0, "not retryable"},
+		{"plain error", 1, errors.New("boom"), 0, "not retryable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, reason := policy.nextDelay(tt.attempt, tt.err)
+			if delay != tt.wantDelay || reason != tt.wantReason {
+				t.Errorf("nextDelay(%d) = %v, %q, want %v, %q", tt.attempt, delay, reason, tt.wantDelay, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Jitter(t *testing.T) {
+	policy := &RetryPolicy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, BackoffFactor: 2.0, Jitter: true}
+	err := NewClaudeError(ErrorNetwork, "reset")
+
+	distinct := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		delay, _ := policy.nextDelay(3, err)
+		if delay < 0 || delay > 400*time.Millisecond {
+			t.Fatalf("Jittered delay %v outside [0, 400ms]", delay)
+		}
+		distinct[delay] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("Expected jitter to randomize delays")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(0.5, 1, time.Minute)
+
+	budget.recordRequest()
+	budget.recordRequest()
+	// One minimum retry plus half of two requests
+	for i := 0; i < 2; i++ {
+		if !budget.tryRetry() {
+			t.Fatalf("Expected retry %d to be allowed", i+1)
+		}
+	}
+	if budget.tryRetry() {
+		t.Error("Expected budget to be exhausted")
+	}
+
+	// Events outside the window no longer count
+	expired := NewRetryBudget(0, 1, time.Millisecond)
+	expired.tryRetry()
+	time.Sleep(5 * time.Millisecond)
+	if !expired.tryRetry() {
+		t.Error("Expected retries to be released after the window")
+	}
+}
+
+func TestRunPromptWithRetryCtx(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	jsonOutput := `{"type":"result","subtype":"success","result":"ok","session_id":"abc"}`
+	fastPolicy := func() *RetryPolicy {
+		return &RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+	}
+
+	t.Run("succeeds after retries and calls OnRetry", func(t *testing.T) {
+		calls := 0
+		execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+			calls++
+			if calls < 3 {
+				return mockExecCommandStderr("", "network error: connection reset", 1)(ctx, name, arg...)
+			}
+			return mockExecCommandStderr(jsonOutput, "", 0)(ctx, name, arg...)
+		}
+
+		var retried []int
+		policy := fastPolicy()
+		policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+			retried = append(retried, attempt)
+		}
+
+		result, err := NewClient("claude").RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, policy)
+		if err != nil {
+			t.Fatalf("Expected success, got %v", err)
+		}
+		if result.Result != "ok" || calls != 3 {
+			t.Errorf("Expected result after 3 calls, got %q after %d", result.Result, calls)
+		}
+		if len(retried) != 2 || retried[0] != 1 || retried[1] != 2 {
+			t.Errorf("Expected OnRetry for attempts 1 and 2, got %v", retried)
+		}
+	})
+
+	t.Run("returns RetryError listing every attempt", func(t *testing.T) {
+		execCommand = mockExecCommandStderr("", "network error: connection reset", 1)
+
+		_, err := NewClient("claude").RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, fastPolicy())
+
+		var retryErr *RetryError
+		if !errors.As(err, &retryErr) {
+			t.Fatalf("Expected RetryError, got %v", err)
+		}
+		if len(retryErr.Attempts) != 4 || !strings.HasPrefix(retryErr.Error(), "max retries (3) exceeded after 4 attempts") {
+			t.Errorf("Unexpected RetryError: %v", retryErr)
+		}
+		var claudeErr *ClaudeError
+		if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorNetwork {
+			t.Errorf("Expected last ClaudeError to be unwrapped, got %v", claudeErr)
+		}
+	})
+
+	t.Run("non-retryable errors are returned unwrapped", func(t *testing.T) {
+		calls := 0
+		execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+			calls++
+			return mockExecCommandStderr("", "Error: invalid api key", 1)(ctx, name, arg...)
+		}
+
+		_, err := NewClient("claude").RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, fastPolicy())
+		if _, ok := err.(*ClaudeError); !ok || calls != 1 {
+			t.Errorf("Expected unwrapped ClaudeError after 1 call, got %T after %d", err, calls)
+		}
+	})
+
+	t.Run("cancellation during backoff keeps the attempts", func(t *testing.T) {
+		execCommand = mockExecCommandStderr("", "network error: connection reset", 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := fastPolicy()
+		policy.BaseDelay, policy.MaxDelay = time.Minute, time.Minute
+		policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+			cancel()
+		}
+
+		_, err := NewClient("claude").RunPromptWithRetryCtx(ctx, "test", &RunOptions{Format: JSONOutput}, policy)
+		var retryErr *RetryError
+		if !errors.As(err, &retryErr) || len(retryErr.Attempts) != 1 || retryErr.Reason != "canceled while waiting to retry" {
+			t.Fatalf("Expected RetryError with the failed attempt, got %v", err)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the cancellation to be found by errors.Is, got %v", err)
+		}
+		var claudeErr *ClaudeError
+		if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorNetwork {
+			t.Errorf("Expected last ClaudeError to be unwrapped, got %v", claudeErr)
+		}
+	})
+
+	t.Run("client retry budget stops retry storms", func(t *testing.T) {
+		execCommand = mockExecCommandStderr("", "network error: connection reset", 1)
+
+		client := NewClient("claude", WithRetryBudget(NewRetryBudget(0, 1, time.Minute)))
+		_, err := client.RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, fastPolicy())
+
+		var retryErr *RetryError
+		if !errors.As(err, &retryErr) || retryErr.Reason != "retry budget exhausted" || len(retryErr.Attempts) != 2 {
+			t.Errorf("Expected budget to stop after one retry, got %v", err)
+		}
+	})
+}
+
+func TestQuerySync_RetryPolicy(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	calls := 0
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		if calls == 1 {
+			return mockExecCommandStderr("", "network error: connection reset", 1)(ctx, name, arg...)
+		}
+		return mockExecCommandStderr(`{"type":"result","result":"ok","session_id":"abc"}`, "", 0)(ctx, name, arg...)
+	}
+
+	result, err := NewClient("claude").QuerySync(context.Background(), "test", QueryOptions{
+		RetryPolicy: &RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1},
+	})
+	if err != nil || result.Result != "ok" || calls != 2 {
+		t.Errorf("Expected QuerySync to retry once, got %v, %v after %d calls", result, err, calls)
+	}
+}
+
+func TestStreamPromptWithRetry(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	policy := &RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+
+	t.Run("retries before any message is delivered", func(t *testing.T) {
+		calls := 0
+		execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+			calls++
+			if calls == 1 {
+				return mockExecCommandStderr("", "network error: connection reset", 1)(ctx, name, arg...)
+			}
+			return mockExecCommandStderr(`{"type":"result","result":"ok","session_id":"abc"}`+"\n", "", 0)(ctx, name, arg...)
+		}
+
+		messages, err := collectStream(NewClient("claude").StreamPromptWithRetry(context.Background(), "test", &RunOptions{}, policy))
+		if err != nil || len(messages) != 1 || calls != 2 {
+			t.Errorf("Expected one message after a retry, got %d messages, %v after %d calls", len(messages), err, calls)
+		}
+	})
+
+	t.Run("does not retry once output was delivered", func(t *testing.T) {
+		calls := 0
+		execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+			calls++
+			return mockExecCommandStderr(`{"type":"system","subtype":"init","session_id":"abc"}`+"\n", "network error: connection reset", 1)(ctx, name, arg...)
+		}
+
+		_, err := collectStream(NewClient("claude").StreamPromptWithRetry(context.Background(), "test", &RunOptions{}, policy))
+		if _, ok := err.(*ClaudeError); !ok || calls != 1 {
+			t.Errorf("Expected the stream error without retrying, got %v after %d calls", err, calls)
+		}
+	})
+}
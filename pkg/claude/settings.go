@@ -0,0 +1,325 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SettingsSource identifies where a permission rule comes from
+type SettingsSource string
+
+const (
+	// SettingsManaged is the enterprise managed-settings.json, which overrides every other layer
+	SettingsManaged SettingsSource = "managed"
+	// SettingsRunOptions is RunOptions: AllowedTools, DisallowedTools and the Settings flag
+	SettingsRunOptions SettingsSource = "run_options"
+	// SettingsLocal is the project's .claude/settings.local.json, usually not checked in
+	SettingsLocal SettingsSource = "local"
+	// SettingsProject is the project's shared .claude/settings.json
+	SettingsProject SettingsSource = "project"
+	// SettingsUser is ~/.claude/settings.json
+	SettingsUser SettingsSource = "user"
+)
+
+// SettingsPermissions is the "permissions" object of a Claude settings file
+type SettingsPermissions struct {
+	Allow                 []string       `json:"allow,omitempty"`
+	Deny                  []string       `json:"deny,omitempty"`
+	Ask                   []string       `json:"ask,omitempty"`
+	DefaultMode           PermissionMode `json:"defaultMode,omitempty"`
+	AdditionalDirectories []string       `json:"additionalDirectories,omitempty"`
+}
+
+// SettingsLayer is one settings file, or the rules given in RunOptions
+type SettingsLayer struct {
+	Source SettingsSource
+	// Path is the settings file, or empty for rules that did not come from a file
+	Path string
+	// Exists is false when the file was not found; missing files are not an error
+	Exists      bool
+	Permissions SettingsPermissions
+}
+
+// SettingsOptions configures LoadSettings
+type SettingsOptions struct {
+	// ProjectDir holds the .claude directory (default: current directory)
+	ProjectDir string
+	// HomeDir holds the user's .claude directory (default: os.UserHomeDir)
+	HomeDir string
+	// ManagedPath is the managed settings file (default: the platform's location)
+	// Set it to "-" to skip the managed layer
+	ManagedPath string
+}
+
+// Settings holds the settings layers in precedence order, highest first
+type Settings struct {
+	Layers     []SettingsLayer
+	projectDir string
+}
+
+// DefaultManagedSettingsPath returns the platform's enterprise managed settings file
+func DefaultManagedSettingsPath() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "/Library/Application Support/ClaudeCode/managed-settings.json"
+	case "windows":
+		return `C:\ProgramData\ClaudeCode\managed-settings.json`
+	default:
+		return "/etc/claude-code/managed-settings.json"
+	}
+}
+
+// LoadSettings reads the managed, local, project and user settings files
+// Layers are returned in the CLI's precedence order; files that do not exist are kept with Exists false
+func LoadSettings(opts SettingsOptions) (*Settings, error) {
+	if opts.ProjectDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine project directory: %w", err)
+		}
+		opts.ProjectDir = wd
+	}
+	if opts.HomeDir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			opts.HomeDir = home
+		}
+	}
+	if opts.ManagedPath == "" {
+		opts.ManagedPath = DefaultManagedSettingsPath()
+	}
+
+	var files []SettingsLayer
+	if opts.ManagedPath != "-" {
+		files = append(files, SettingsLayer{Source: SettingsManaged, Path: opts.ManagedPath})
+	}
+	files = append(files,
+		SettingsLayer{Source: SettingsLocal, Path: filepath.Join(opts.ProjectDir, ".claude", "settings.local.json")},
+		SettingsLayer{Source: SettingsProject, Path: filepath.Join(opts.ProjectDir, ".claude", "settings.json")},
+	)
+	if opts.HomeDir != "" {
+		files = append(files, SettingsLayer{Source: SettingsUser, Path: filepath.Join(opts.HomeDir, ".claude", "settings.json")})
+	}
+
+	settings := &Settings{projectDir: opts.ProjectDir}
+	for _, layer := range files {
+		data, err := os.ReadFile(layer.Path)
+		if os.IsNotExist(err) {
+			settings.Layers = append(settings.Layers, layer)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s settings: %w", layer.Source, err)
+		}
+		if err := parseSettingsPermissions(data, &layer.Permissions); err != nil {
+			return nil, fmt.Errorf("failed to parse %s settings %s: %w", layer.Source, layer.Path, err)
+		}
+		layer.Exists = true
+		settings.Layers = append(settings.Layers, layer)
+	}
+	return settings, nil
+}
+
+// LoadEffectivePermissions loads the settings for a run's WorkingDir and merges them with opts
+func LoadEffectivePermissions(opts *RunOptions) (*EffectivePermissions, error) {
+	var settingsOpts SettingsOptions
+	if opts != nil {
+		settingsOpts.ProjectDir = opts.WorkingDir
+	}
+	settings, err := LoadSettings(settingsOpts)
+	if err != nil {
+		return nil, err
+	}
+	return settings.Effective(opts)
+}
+
+// parseSettingsPermissions reads the "permissions" object of a settings document
+func parseSettingsPermissions(data []byte, perms *SettingsPermissions) error {
+	var doc struct {
+		Permissions SettingsPermissions `json:"permissions"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	*perms = doc.Permissions
+	return nil
+}
+
+// runOptionsLayer builds the layer for RunOptions
+// The Settings flag is a file path or inline JSON; its rules are merged with AllowedTools and DisallowedTools
+func runOptionsLayer(opts *RunOptions, projectDir string) (SettingsLayer, error) {
+	layer := SettingsLayer{Source: SettingsRunOptions}
+	if opts == nil {
+		return layer, nil
+	}
+
+	if opts.Settings != "" {
+		data := []byte(opts.Settings)
+		if !strings.HasPrefix(strings.TrimSpace(opts.Settings), "{") {
+			layer.Path = opts.Settings
+			if !filepath.IsAbs(layer.Path) && projectDir != "" {
+				layer.Path = filepath.Join(projectDir, layer.Path)
+			}
+			var err error
+			if data, err = os.ReadFile(layer.Path); err != nil {
+				return layer, fmt.Errorf("failed to read settings: %w", err)
+			}
+		}
+		if err := parseSettingsPermissions(data, &layer.Permissions); err != nil {
+			return layer, fmt.Errorf("failed to parse settings: %w", err)
+		}
+	}
+
+	layer.Exists = true
+	layer.Permissions.Allow = append(append([]string(nil), opts.AllowedTools...), layer.Permissions.Allow...)
+	layer.Permissions.Deny = append(append([]string(nil), opts.DisallowedTools...), layer.Permissions.Deny...)
+	if opts.PermissionMode != "" {
+		layer.Permissions.DefaultMode = opts.PermissionMode
+	}
+	return layer, nil
+}
+
+// EffectiveRule is a permission rule with its provenance
+type EffectiveRule struct {
+	Decision Decision
+	Rule     string
+	Source   SettingsSource
+	// Path is the settings file the rule was read from, empty for AllowedTools and DisallowedTools
+	Path string
+	// Err is set when the rule cannot be parsed; see EffectivePermissions.Policy
+	Err error `json:"-"`
+}
+
+// String returns the rule with its source, e.g. "deny Bash(rm:*) (project)"
+func (r EffectiveRule) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Decision, r.Rule, r.Source)
+}
+
+// EffectivePermissions is the merged rule set a run will be evaluated against
+type EffectivePermissions struct {
+	// Rules are the valid rules of every layer in precedence order: deny, ask, allow,
+	// and within each decision the highest-precedence layer first
+	// A rule repeated in lower layers is listed once with the source that defines it first
+	Rules []EffectiveRule
+	// Invalid lists rules that could not be parsed; Policy fails if any of them is a deny or ask rule
+	Invalid []EffectiveRule
+	// DefaultMode is the permission mode from the highest layer that sets one
+	DefaultMode       PermissionMode
+	DefaultModeSource SettingsSource
+	// AdditionalDirectories merges the directories of every layer
+	AdditionalDirectories []string
+	// ProjectDir is the directory file rules are resolved against
+	ProjectDir string
+}
+
+// Effective merges the settings layers with opts into the effective rule set
+// RunOptions rules rank below managed settings and above the local, project and user files
+func (s *Settings) Effective(opts *RunOptions) (*EffectivePermissions, error) {
+	runLayer, err := runOptionsLayer(opts, s.projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]SettingsLayer, 0, len(s.Layers)+1)
+	for _, layer := range s.Layers {
+		if layer.Source == SettingsManaged {
+			layers = append(layers, layer)
+		}
+	}
+	layers = append(layers, runLayer)
+	for _, layer := range s.Layers {
+		if layer.Source != SettingsManaged {
+			layers = append(layers, layer)
+		}
+	}
+
+	effective := &EffectivePermissions{ProjectDir: s.projectDir}
+	seen := make(map[string]bool)
+	for _, decision := range []Decision{DecisionDeny, DecisionAsk, DecisionAllow} {
+		for _, layer := range layers {
+			for _, rule := range layer.Permissions.rules(decision) {
+				key := string(decision) + " " + rule
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				r := EffectiveRule{Decision: decision, Rule: rule, Source: layer.Source, Path: layer.Path}
+				if _, err := ParseToolPermission(rule); err != nil {
+					r.Err = err
+					effective.Invalid = append(effective.Invalid, r)
+					continue
+				}
+				effective.Rules = append(effective.Rules, r)
+			}
+		}
+	}
+
+	dirs := make(map[string]bool)
+	for _, layer := range layers {
+		if effective.DefaultMode == "" && layer.Permissions.DefaultMode != "" {
+			effective.DefaultMode = layer.Permissions.DefaultMode
+			effective.DefaultModeSource = layer.Source
+		}
+		for _, dir := range layer.Permissions.AdditionalDirectories {
+			if !dirs[dir] {
+				dirs[dir] = true
+				effective.AdditionalDirectories = append(effective.AdditionalDirectories, dir)
+			}
+		}
+	}
+	return effective, nil
+}
+
+// rules returns the rules of one decision
+func (p SettingsPermissions) rules(decision Decision) []string {
+	switch decision {
+	case DecisionDeny:
+		return p.Deny
+	case DecisionAsk:
+		return p.Ask
+	default:
+		return p.Allow
+	}
+}
+
+// Policy builds a Policy from the effective rules, resolving file rules against ProjectDir
+// Invalid allow rules are left out, which only denies more; an invalid deny or ask rule is an error,
+// since dropping it could let a broader allow rule through
+func (e *EffectivePermissions) Policy() (*Policy, error) {
+	for _, rule := range e.Invalid {
+		if rule.Decision != DecisionAllow {
+			return nil, NewValidationError(
+				fmt.Sprintf("Invalid %s rule %q in %s settings: %v", rule.Decision, rule.Rule, rule.Source, rule.Err),
+				"permissions."+string(rule.Decision), rule.Rule)
+		}
+	}
+
+	opts := PolicyOptions{Match: MatchOptions{BaseDir: e.ProjectDir}}
+	for _, rule := range e.Rules {
+		switch rule.Decision {
+		case DecisionDeny:
+			opts.Deny = append(opts.Deny, rule.Rule)
+		case DecisionAsk:
+			opts.Ask = append(opts.Ask, rule.Rule)
+		default:
+			opts.Allow = append(opts.Allow, rule.Rule)
+		}
+	}
+	return NewPolicy(opts)
+}
+
+// Source returns the provenance of the rule that decided, or nil when the default applied
+func (e *EffectivePermissions) Source(decision PolicyDecision) *EffectiveRule {
+	if decision.Rule == nil {
+		return nil
+	}
+	for i, rule := range e.Rules {
+		if rule.Decision == decision.Rule.Decision && rule.Rule == decision.Rule.Permission.Original {
+			return &e.Rules[i]
+		}
+	}
+	return nil
+}
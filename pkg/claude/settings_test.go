@@ -0,0 +1,163 @@
+package claude
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSettings writes a settings file, creating its directory
+func writeSettings(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSettings_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "repo")
+	home := filepath.Join(dir, "home")
+	managed := filepath.Join(dir, "managed-settings.json")
+
+	writeSettings(t, managed, `{"permissions": {"deny": ["WebFetch"]}}`)
+	writeSettings(t, filepath.Join(home, ".claude", "settings.json"),
+		`{"permissions": {"allow": ["Bash(git log:*)", "Read"], "defaultMode": "plan", "additionalDirectories": ["../shared"]}}`)
+	writeSettings(t, filepath.Join(project, ".claude", "settings.json"),
+		`{"model": "sonnet", "permissions": {"allow": ["Edit(src/**)", "Read"], "deny": ["Edit(src/secrets/**)"], "ask": ["Bash(git push:*)"]}}`)
+	writeSettings(t, filepath.Join(project, ".claude", "settings.local.json"),
+		`{"permissions": {"allow": ["Bash(git push:*)", "Bash("], "defaultMode": "acceptEdits"}}`)
+
+	settings, err := LoadSettings(SettingsOptions{ProjectDir: project, HomeDir: home, ManagedPath: managed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, layer := range settings.Layers {
+		if !layer.Exists {
+			t.Errorf("Expected %s settings to exist", layer.Source)
+		}
+		sources = append(sources, string(layer.Source))
+	}
+	if got := strings.Join(sources, ","); got != "managed,local,project,user" {
+		t.Errorf("Layers = %s, want managed,local,project,user", got)
+	}
+
+	effective, err := settings.Effective(&RunOptions{AllowedTools: []string{"Bash(go test:*)"}, DisallowedTools: []string{"Bash(rm:*)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, rule := range effective.Rules {
+		got = append(got, rule.String())
+	}
+	want := []string{
+		"deny WebFetch (managed)",
+		"deny Bash(rm:*) (run_options)",
+		"deny Edit(src/secrets/**) (project)",
+		"ask Bash(git push:*) (project)",
+		"allow Bash(go test:*) (run_options)",
+		"allow Bash(git push:*) (local)",
+		"allow Edit(src/**) (project)",
+		"allow Read (project)",
+		"allow Bash(git log:*) (user)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Rules =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(effective.Invalid) != 1 || effective.Invalid[0].Rule != "Bash(" || effective.Invalid[0].Err == nil {
+		t.Errorf("Expected the malformed local rule to be reported, got %+v", effective.Invalid)
+	}
+	if effective.DefaultMode != PermissionModeAcceptEdits || effective.DefaultModeSource != SettingsLocal {
+		t.Errorf("DefaultMode = %s from %s, want acceptEdits from local", effective.DefaultMode, effective.DefaultModeSource)
+	}
+	if len(effective.AdditionalDirectories) != 1 {
+		t.Errorf("AdditionalDirectories = %v", effective.AdditionalDirectories)
+	}
+
+	policy, err := effective.Policy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decision := policy.Evaluate("Bash", map[string]interface{}{"command": "git push origin main"})
+	if decision.Decision != DecisionAsk {
+		t.Errorf("Expected the project ask rule to override the local allow, got %+v", decision)
+	}
+	if source := effective.Source(decision); source == nil || source.Source != SettingsProject || !strings.HasSuffix(source.Path, "settings.json") {
+		t.Errorf("Expected provenance in the project settings, got %+v", source)
+	}
+	decision = policy.Evaluate("Edit", map[string]interface{}{"file_path": filepath.Join(project, "src", "main.go")})
+	if decision.Decision != DecisionAllow {
+		t.Errorf("Expected edits in src to be allowed, got %+v", decision)
+	}
+}
+
+func TestLoadSettings_MissingAndInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	settings, err := LoadSettings(SettingsOptions{ProjectDir: dir, HomeDir: dir, ManagedPath: "-"})
+	if err != nil {
+		t.Fatalf("Expected missing files to be ignored, got %v", err)
+	}
+	if len(settings.Layers) != 3 {
+		t.Errorf("Expected local, project and user layers, got %d", len(settings.Layers))
+	}
+	for _, layer := range settings.Layers {
+		if layer.Exists {
+			t.Errorf("Expected %s settings to be missing", layer.Source)
+		}
+	}
+
+	writeSettings(t, filepath.Join(dir, ".claude", "settings.json"), `{"permissions": `)
+	if _, err := LoadSettings(SettingsOptions{ProjectDir: dir, HomeDir: dir, ManagedPath: "-"}); err == nil || !strings.Contains(err.Error(), "project settings") {
+		t.Errorf("Expected a parse error naming the project settings, got %v", err)
+	}
+}
+
+func TestSettings_EffectiveRunOptionsSettings(t *testing.T) {
+	dir := t.TempDir()
+	settings, err := LoadSettings(SettingsOptions{ProjectDir: dir, HomeDir: dir, ManagedPath: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	effective, err := settings.Effective(&RunOptions{Settings: `{"permissions": {"deny": ["Bash(curl:*)"]}}`, PermissionMode: PermissionModePlan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(effective.Rules) != 1 || effective.Rules[0].Source != SettingsRunOptions || effective.Rules[0].Path != "" {
+		t.Errorf("Expected the inline settings rule, got %+v", effective.Rules)
+	}
+	if effective.DefaultMode != PermissionModePlan {
+		t.Errorf("Expected PermissionMode to set the default mode, got %s", effective.DefaultMode)
+	}
+
+	writeSettings(t, filepath.Join(dir, "ci-settings.json"), `{"permissions": {"allow": ["Bash(make:*)"]}}`)
+	effective, err = settings.Effective(&RunOptions{Settings: "ci-settings.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(effective.Rules) != 1 || effective.Rules[0].Path != filepath.Join(dir, "ci-settings.json") {
+		t.Errorf("Expected the settings file rule with its path, got %+v", effective.Rules)
+	}
+
+	if _, err := settings.Effective(&RunOptions{Settings: "missing.json"}); err == nil {
+		t.Error("Expected an error for a missing settings file")
+	}
+
+	// A mistyped deny rule must not silently disappear from the policy
+	effective, err = settings.Effective(&RunOptions{Settings: `{"permissions": {"allow": ["Bash"], "deny": ["Bash(rm:*"]}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := effective.Policy(); !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "Bash(rm:*") {
+		t.Errorf("Expected a validation error for the invalid deny rule, got %v", err)
+	}
+}
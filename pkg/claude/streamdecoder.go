@@ -0,0 +1,332 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// StreamMode controls how StreamPrompt handles stdout lines that are not valid messages
+type StreamMode string
+
+const (
+	// StreamTolerant delivers bad lines as diagnostic messages and keeps reading
+	StreamTolerant StreamMode = ""
+	// StreamStrict ends the stream with an error on the first bad line
+	StreamStrict StreamMode = "strict"
+)
+
+// isValidStreamMode checks if the stream mode is supported
+func isValidStreamMode(mode StreamMode) bool {
+	switch mode {
+	case StreamTolerant, StreamStrict:
+		return true
+	default:
+		return false
+	}
+}
+
+// DefaultMaxLineSize is the longest stream-json line decoded when buffer.Config.MaxLineSize is zero
+const DefaultMaxLineSize = 10 * 1024 * 1024 // 10MB
+
+// MessageTypeDiagnostic is the type of messages describing stdout lines that could not be decoded
+const MessageTypeDiagnostic = "diagnostic"
+
+// StreamLineReason describes why a stdout line could not be decoded; it is the diagnostic message's subtype
+type StreamLineReason string
+
+const (
+	// LineNotJSON is a line that is not a JSON message, such as a warning printed by the CLI
+	LineNotJSON StreamLineReason = "non_json"
+	// LineTooLong is a line longer than the maximum line size; its content is discarded
+	LineTooLong StreamLineReason = "line_too_long"
+)
+
+// StreamLineError describes a stdout line that could not be decoded
+type StreamLineError struct {
+	Reason StreamLineReason
+	// Line is the 1-based line number
+	Line int
+	// Size is the length of the line in bytes
+	Size int64
+	// Limit is the maximum line size for LineTooLong
+	Limit int
+	// Text is the trimmed line for LineNotJSON
+	Text string
+	// Err is the JSON error for LineNotJSON
+	Err error
+}
+
+// Error implements the error interface
+func (e *StreamLineError) Error() string {
+	if e.Reason == LineTooLong {
+		return fmt.Sprintf("stream line %d is %d bytes, exceeding the %d byte limit", e.Line, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("stream line %d is not a JSON message: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the JSON error
+func (e *StreamLineError) Unwrap() error {
+	return e.Err
+}
+
+// message converts the error into a diagnostic message
+func (e *StreamLineError) message() Message {
+	msg := Message{
+		Type:       MessageTypeDiagnostic,
+		Subtype:    string(e.Reason),
+		Content:    e.Text,
+		IsError:    e.Reason == LineTooLong,
+		Diagnostic: e,
+	}
+	if e.Reason == LineTooLong {
+		msg.Content = e.Error()
+	}
+	return msg
+}
+
+// MessageBody is the typed "message" field of assistant and user messages
+type MessageBody struct {
+	ID         string        `json:"id,omitempty"`
+	Role       string        `json:"role,omitempty"`
+	Model      string        `json:"model,omitempty"`
+	Content    ContentBlocks `json:"content,omitempty"`
+	Text       string        `json:"text,omitempty"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Usage      *Usage        `json:"usage,omitempty"`
+}
+
+// text returns a plain string content, or the body's text
+func (b *MessageBody) text() string {
+	if len(b.Content) == 1 && b.Content[0].plain {
+		return b.Content[0].Text
+	}
+	return b.Text
+}
+
+// ContentBlock is a content block of a message: text, thinking, tool_use or tool_result
+type ContentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+	// ID, Name and Input describe a tool_use block
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// ToolUseID, Content and IsError describe a tool_result block
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+
+	plain bool // decoded from a plain string content
+}
+
+// ContentBlocks is the content of a message; a plain string becomes a single text block
+type ContentBlocks []ContentBlock
+
+// UnmarshalJSON accepts a string or an array of content blocks
+func (c *ContentBlocks) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*c = ContentBlocks{{Type: "text", Text: text, plain: true}}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]ContentBlock)(c))
+}
+
+// wireMessage decodes a stream line in one pass, keeping the raw message next to its typed body
+type wireMessage struct {
+	Message
+	Raw messageField `json:"message"`
+}
+
+// messageField keeps a copy of the raw "message" field and decodes it into a MessageBody
+type messageField struct {
+	raw  json.RawMessage
+	body *MessageBody
+}
+
+// UnmarshalJSON never fails; a message that does not fit MessageBody keeps only its raw form
+func (f *messageField) UnmarshalJSON(data []byte) error {
+	f.raw = append(json.RawMessage(nil), data...)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var body MessageBody
+	if json.Unmarshal(data, &body) == nil {
+		f.body = &body
+	}
+	return nil
+}
+
+// decodeMessage decodes one stream line into a Message with its typed Body
+// Content is filled from the body for Python SDK alignment
+func decodeMessage(line []byte) (Message, error) {
+	var w wireMessage
+	if err := json.Unmarshal(line, &w); err != nil {
+		return Message{}, err
+	}
+	msg := w.Message
+	msg.Message = w.Raw.raw
+	msg.Body = w.Raw.body
+	if msg.Content == "" && msg.Body != nil {
+		msg.Content = msg.Body.text()
+	}
+	return msg, nil
+}
+
+// readerSize is the size of the pooled line readers
+const readerSize = 64 * 1024
+
+// maxPooledLine is the largest line buffer returned to the pool
+const maxPooledLine = 1024 * 1024
+
+// readerPool and linePool reuse read buffers across streams
+var (
+	readerPool = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, readerSize) }}
+	linePool   = sync.Pool{New: func() any { return new([]byte) }}
+)
+
+// errDecoderClosed is returned by Next after Close
+var errDecoderClosed = errors.New("stream decoder is closed")
+
+// StreamDecoder reads stream-json messages line by line, decoding each line once
+// Lines longer than the maximum are discarded while reading, so a giant line costs no more memory than the limit
+// Read buffers are pooled and returned when the stream ends or Close is called
+type StreamDecoder struct {
+	r       *bufio.Reader
+	maxLine int
+	mode    StreamMode
+	buf     *[]byte
+	line    int
+	bytes   int64
+	err     error
+}
+
+// NewStreamDecoder creates a decoder; maxLineSize <= 0 means DefaultMaxLineSize
+func NewStreamDecoder(r io.Reader, maxLineSize int, mode StreamMode) *StreamDecoder {
+	if maxLineSize <= 0 {
+		maxLineSize = DefaultMaxLineSize
+	}
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(r)
+	return &StreamDecoder{
+		r:       reader,
+		maxLine: maxLineSize,
+		mode:    mode,
+		buf:     linePool.Get().(*[]byte),
+	}
+}
+
+// Next returns the next message, or io.EOF at the end of the stream
+// Bad lines are returned as diagnostic messages in tolerant mode and as a *StreamLineError in strict mode
+func (d *StreamDecoder) Next() (Message, error) {
+	for {
+		if d.err != nil {
+			d.release()
+			return Message{}, d.err
+		}
+
+		line, size, tooLong := d.readLine()
+		if size == 0 {
+			continue // d.err is set
+		}
+		d.line++
+
+		if tooLong {
+			return d.bad(&StreamLineError{Reason: LineTooLong, Line: d.line, Size: size, Limit: d.maxLine})
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		msg, err := decodeMessage(line)
+		if err != nil {
+			return d.bad(&StreamLineError{Reason: LineNotJSON, Line: d.line, Size: size, Text: string(line), Err: err})
+		}
+		return msg, nil
+	}
+}
+
+// Bytes returns the number of bytes read so far
+func (d *StreamDecoder) Bytes() int64 {
+	return d.bytes
+}
+
+// Close returns the decoder's buffers to the pool; Next returns an error afterwards
+func (d *StreamDecoder) Close() {
+	if d.err == nil {
+		d.err = errDecoderClosed
+	}
+	d.release()
+}
+
+// release returns the buffers to the pool once
+func (d *StreamDecoder) release() {
+	if d.r == nil {
+		return
+	}
+	d.r.Reset(nil)
+	readerPool.Put(d.r)
+	d.r = nil
+	// Buffers grown by giant lines are left to the garbage collector
+	if cap(*d.buf) <= maxPooledLine {
+		*d.buf = (*d.buf)[:0]
+		linePool.Put(d.buf)
+	}
+	d.buf = nil
+}
+
+// bad reports an undecodable line according to the mode
+func (d *StreamDecoder) bad(lineErr *StreamLineError) (Message, error) {
+	if d.mode == StreamStrict {
+		return Message{}, lineErr
+	}
+	return lineErr.message(), nil
+}
+
+// readLine reads one line, keeping at most maxLine bytes of it
+// It returns the line's total size and whether it was too long; read errors are kept in d.err
+// Lines that fit the reader are returned without copying
+func (d *StreamDecoder) readLine() ([]byte, int64, bool) {
+	buf := (*d.buf)[:0]
+	var size int64
+	tooLong := false
+	for {
+		chunk, err := d.r.ReadSlice('\n')
+		size += int64(len(chunk))
+		d.bytes += int64(len(chunk))
+		if !tooLong {
+			if len(buf)+len(bytes.TrimRight(chunk, "\r\n")) > d.maxLine {
+				tooLong = true
+				buf = buf[:0]
+			} else if err != bufio.ErrBufferFull && len(buf) == 0 {
+				// The whole line is in the reader's buffer, valid until the next read
+				*d.buf = buf
+				if err != nil {
+					d.err = err
+				}
+				return chunk, size, false
+			} else {
+				buf = append(buf, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		*d.buf = buf
+		if err != nil {
+			d.err = err
+		}
+		return buf, size, tooLong
+	}
+}
@@ -0,0 +1,292 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestStreamDecoder_Tolerant(t *testing.T) {
+	input := `{"type":"system","subtype":"init","session_id":"s1"}
+Warning: update available
+
+{"type":"assistant","message":{"content":"` + strings.Repeat("x", 200) + `"},"session_id":"s1"}
+{"type":"assistant","message":{"text":"hi"},"session_id":"s1"}
+{"type":"result","subtype":"success","result":"done","session_id":"s1"}`
+
+	decoder := NewStreamDecoder(strings.NewReader(input), 128, StreamTolerant)
+	var messages []Message
+	for {
+		msg, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if len(messages) != 5 {
+		t.Fatalf("Expected 5 messages, got %+v", messages)
+	}
+	if m := messages[1]; m.Type != MessageTypeDiagnostic || m.Subtype != string(LineNotJSON) || m.Content != "Warning: update available" || m.IsError {
+		t.Errorf("Unexpected non-JSON diagnostic: %+v", m)
+	}
+	if m := messages[2]; m.Subtype != string(LineTooLong) || !m.IsError || m.Diagnostic == nil || m.Diagnostic.Line != 4 || m.Diagnostic.Limit != 128 {
+		t.Errorf("Unexpected oversized line diagnostic: %+v", m)
+	}
+	if messages[3].Content != "hi" {
+		t.Errorf("Expected content from the raw message, got %q", messages[3].Content)
+	}
+	if messages[4].Type != "result" || messages[4].Result != "done" {
+		t.Errorf("Expected final line without newline to be decoded, got %+v", messages[4])
+	}
+	if decoder.Bytes() != int64(len(input)) {
+		t.Errorf("Bytes() = %d, want %d", decoder.Bytes(), len(input))
+	}
+}
+
+func TestStreamDecoder_Strict(t *testing.T) {
+	decoder := NewStreamDecoder(strings.NewReader("{\"type\":\"system\"}\nnot json\n"), 0, StreamStrict)
+	if msg, err := decoder.Next(); err != nil || msg.Type != "system" {
+		t.Fatalf("Next() = %+v, %v", msg, err)
+	}
+
+	_, err := decoder.Next()
+	var lineErr *StreamLineError
+	if !errors.As(err, &lineErr) || lineErr.Reason != LineNotJSON || lineErr.Line != 2 || lineErr.Text != "not json" {
+		t.Errorf("Expected non-JSON line error, got %v", err)
+	}
+}
+
+func TestStreamDecoder_GiantLineMemory(t *testing.T) {
+	giant := strings.Repeat("x", 4*1024*1024)
+	decoder := NewStreamDecoder(strings.NewReader(giant+"\n{\"type\":\"result\"}\n"), 1024, StreamTolerant)
+
+	msg, err := decoder.Next()
+	if err != nil || msg.Subtype != string(LineTooLong) || msg.Diagnostic.Size != int64(len(giant)+1) {
+		t.Fatalf("Expected oversized line diagnostic, got %+v, %v", msg, err)
+	}
+	if cap(*decoder.buf) > 4*1024 {
+		t.Errorf("Expected the line buffer to stay near the limit, got capacity %d", cap(*decoder.buf))
+	}
+	if msg, err := decoder.Next(); err != nil || msg.Type != "result" {
+		t.Errorf("Expected decoding to continue after the oversized line, got %+v, %v", msg, err)
+	}
+}
+
+func TestStreamPrompt_NonJSONLines(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = mockExecCommandStderr(`{"type":"system","subtype":"init","session_id":"s1"}
+Warning: running in a deprecated mode
+{"type":"result","subtype":"success","result":"done","session_id":"s1"}
+`, "", 0)
+	client := &ClaudeClient{BinPath: "claude"}
+
+	messages, err := collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{}))
+	if err != nil {
+		t.Fatalf("Expected tolerant stream to succeed, got %v", err)
+	}
+	if len(messages) != 3 || messages[1].Type != MessageTypeDiagnostic || messages[2].Type != "result" {
+		t.Errorf("Expected the warning as a diagnostic message, got %+v", messages)
+	}
+
+	messages, err = collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{StreamMode: StreamStrict}))
+	var lineErr *StreamLineError
+	if !errors.Is(err, ErrValidation) || !errors.As(err, &lineErr) {
+		t.Errorf("Expected validation error in strict mode, got %v", err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("Expected only the init message in strict mode, got %+v", messages)
+	}
+}
+
+func TestStreamPrompt_StrictReapsProcess(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	execCommand = mockExecScript(`echo '{"type":"system","subtype":"init"}'; echo 'not json'; exec sleep 5`)
+
+	var buf bytes.Buffer
+	client := NewClient("claude", WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+
+	if _, err := collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{StreamMode: StreamStrict})); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected validation error in strict mode, got %v", err)
+	}
+
+	records := decodeLogs(t, &buf)
+	if len(records) != 1 || records[0]["error_type"] != "validation" {
+		t.Fatalf("Expected the failed invocation to be logged, got %v", records)
+	}
+
+	// The process is killed and waited for before the stream ends, so it is not left behind as a zombie
+	proc, err := os.FindProcess(int(records[0]["pid"].(float64)))
+	if err == nil {
+		err = proc.Signal(syscall.Signal(0))
+	}
+	if !errors.Is(err, os.ErrProcessDone) {
+		t.Errorf("Expected the process to be reaped, got %v", err)
+	}
+}
+
+func TestDecodeMessage_TypedBody(t *testing.T) {
+	msg, err := decodeMessage([]byte(`{"type":"assistant","session_id":"s1","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"Listing"},{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"ls"}}],"usage":{"input_tokens":3}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := msg.Body
+	if body == nil || body.ID != "m1" || len(body.Content) != 2 || body.Usage == nil || body.Usage.InputTokens != 3 {
+		t.Fatalf("Unexpected body: %+v", body)
+	}
+	if tool := body.Content[1]; tool.Type != "tool_use" || tool.Name != "Bash" || string(tool.Input) != `{"command":"ls"}` {
+		t.Errorf("Unexpected tool use block: %+v", tool)
+	}
+	if msg.Content != "" || msg.SessionID != "s1" || !strings.HasPrefix(string(msg.Message), `{"id":"m1"`) {
+		t.Errorf("Expected raw message and no plain content, got %+v", msg)
+	}
+
+	msg, err = decodeMessage([]byte(`{"type":"user","message":{"role":"user","content":"hello"}}`))
+	if err != nil || msg.Content != "hello" || msg.Body.Content[0].Text != "hello" {
+		t.Errorf("Expected string content to fill Content, got %+v, %v", msg, err)
+	}
+
+	// A message that does not fit the typed body keeps its raw form
+	msg, err = decodeMessage([]byte(`{"type":"assistant","message":"plain"}`))
+	if err != nil || msg.Body != nil || string(msg.Message) != `"plain"` {
+		t.Errorf("Expected raw-only message, got %+v, %v", msg, err)
+	}
+}
+
+func TestStreamDecoder_PooledBuffersNotShared(t *testing.T) {
+	first := NewStreamDecoder(strings.NewReader(`{"type":"assistant","message":{"content":"one"}}`+"\n"), 0, StreamStrict)
+	msg, err := first.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	if _, err := first.Next(); err == nil {
+		t.Error("Expected Next to fail after Close")
+	}
+
+	// Reusing the pooled buffers must not change earlier messages
+	second := NewStreamDecoder(strings.NewReader(`{"type":"assistant","message":{"content":"two"}}`+"\n"), 0, StreamStrict)
+	defer second.Close()
+	if _, err := second.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "one" || string(msg.Message) != `{"content":"one"}` {
+		t.Errorf("Expected first message to be unchanged, got %+v", msg)
+	}
+}
+
+// recordedTranscript builds a stream-json transcript shaped like a recorded agent session:
+// assistant turns with text and tool uses, and user messages carrying large tool results
+func recordedTranscript(turns, resultSize int) []byte {
+	var buf strings.Builder
+	buf.WriteString(`{"type":"system","subtype":"init","session_id":"s1","tools":["Bash","Read","Edit"],"model":"claude-sonnet"}` + "\n")
+	result := strings.Repeat(`line of tool output with \"quotes\" and \\path\\n`, resultSize/48)
+	for i := 0; i < turns; i++ {
+		fmt.Fprintf(&buf, `{"type":"assistant","session_id":"s1","message":{"id":"msg_%d","role":"assistant","model":"claude-sonnet","content":[{"type":"text","text":"Reading the next file to understand the change."},{"type":"tool_use","id":"toolu_%d","name":"Read","input":{"file_path":"/repo/pkg/file_%d.go"}}],"stop_reason":"tool_use","usage":{"input_tokens":1200,"output_tokens":85}}}`+"\n", i, i, i)
+		fmt.Fprintf(&buf, `{"type":"user","session_id":"s1","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_%d","content":"%s"}]}}`+"\n", i, result)
+	}
+	buf.WriteString(`{"type":"result","subtype":"success","result":"done","session_id":"s1","num_turns":40,"cost_usd":0.42}` + "\n")
+	return []byte(buf.String())
+}
+
+// legacyDecode is the previous decoding path: each line is unmarshalled into Message,
+// the raw message again for Content, and once more by a consumer looking for tool uses
+func legacyDecode(data []byte) int {
+	tools := 0
+	reader := bufio.NewReaderSize(bytes.NewReader(data), 10*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			var msg Message
+			if json.Unmarshal([]byte(line), &msg) == nil && len(msg.Message) > 0 {
+				var messageContent struct {
+					Content string `json:"content"`
+					Text    string `json:"text"`
+				}
+				if json.Unmarshal(msg.Message, &messageContent) == nil && messageContent.Content != "" {
+					msg.Content = messageContent.Content
+				}
+				var body struct {
+					Content []ContentBlock `json:"content"`
+				}
+				if json.Unmarshal(msg.Message, &body) == nil {
+					for _, block := range body.Content {
+						if block.Type == "tool_use" {
+							tools++
+						}
+					}
+				}
+			}
+		}
+		if err != nil {
+			return tools
+		}
+	}
+}
+
+// decoderDecode decodes with StreamDecoder, reading tool uses from the typed body
+func decoderDecode(data []byte) int {
+	tools := 0
+	decoder := NewStreamDecoder(bytes.NewReader(data), 0, StreamTolerant)
+	defer decoder.Close()
+	for {
+		msg, err := decoder.Next()
+		if err != nil {
+			return tools
+		}
+		if msg.Body != nil {
+			for _, block := range msg.Body.Content {
+				if block.Type == "tool_use" {
+					tools++
+				}
+			}
+		}
+	}
+}
+
+func TestDecoderMatchesLegacy(t *testing.T) {
+	transcript := recordedTranscript(10, 4*1024)
+	if got, want := decoderDecode(transcript), legacyDecode(transcript); got != want || got != 10 {
+		t.Errorf("decoder found %d tool uses, legacy path %d", got, want)
+	}
+}
+
+// BenchmarkStreamDecode compares decoding a ~5MB transcript with the previous path
+// Run with -benchmem to see the allocation reduction
+func BenchmarkStreamDecode(b *testing.B) {
+	transcript := recordedTranscript(40, 128*1024)
+	for _, bm := range []struct {
+		name   string
+		decode func([]byte) int
+	}{
+		{"Legacy", legacyDecode},
+		{"Decoder", decoderDecode},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(transcript)))
+			for i := 0; i < b.N; i++ {
+				bm.decode(transcript)
+			}
+		})
+	}
+}
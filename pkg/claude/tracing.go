@@ -0,0 +1,302 @@
+package claude
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attribute is a key/value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr creates a span attribute
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a timed operation within a trace
+type Span interface {
+	// SetAttributes adds or replaces attributes on the span
+	SetAttributes(attrs ...Attribute)
+	// End finishes the span; calls after the first are ignored
+	End()
+}
+
+// Tracer creates spans for Claude runs, turns and tool uses
+// Implementations adapt this to a tracing system such as OpenTelemetry
+type Tracer interface {
+	// Start creates a span as a child of any span in ctx and returns a context carrying it
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span names used by the client
+const (
+	SpanRun   = "claude.run"
+	SpanRetry = "claude.retry"
+	SpanTurn  = "claude.turn"
+	SpanTool  = "claude.tool"
+)
+
+// WithTracer traces the client's runs with tracer
+func WithTracer(tracer Tracer) ClientOption {
+	return func(c *ClaudeClient) {
+		c.Tracer = tracer
+	}
+}
+
+// tracer returns the client's tracer or a no-op tracer
+func (c *ClaudeClient) tracer() Tracer {
+	if c.Tracer == nil {
+		return NoopTracer{}
+	}
+	return c.Tracer
+}
+
+// NoopTracer discards all spans
+type NoopTracer struct{}
+
+// Start returns ctx unchanged and a span that does nothing
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// noopSpan is the span returned by NoopTracer
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) End()                             {}
+
+// RecordingTracer keeps finished and unfinished spans in memory, mainly for tests
+type RecordingTracer struct {
+	mu     sync.Mutex
+	spans  []*RecordedSpan
+	nextID int
+}
+
+// NewRecordingTracer creates an empty recording tracer
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+// RecordedSpan is a span captured by RecordingTracer
+type RecordedSpan struct {
+	tracer *RecordingTracer
+
+	ID         int
+	ParentID   int // 0 for root spans
+	Name       string
+	Attributes map[string]interface{}
+	Start      time.Time
+	EndTime    time.Time
+	Ended      bool
+}
+
+// recordingSpanKey is the context key for the current RecordedSpan
+type recordingSpanKey struct{}
+
+// Start records a new span, parented to the RecordedSpan in ctx if any
+func (t *RecordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	span := &RecordedSpan{
+		tracer:     t,
+		ID:         t.nextID,
+		Name:       name,
+		Attributes: make(map[string]interface{}),
+		Start:      time.Now(),
+	}
+	if parent, ok := ctx.Value(recordingSpanKey{}).(*RecordedSpan); ok && parent.tracer == t {
+		span.ParentID = parent.ID
+	}
+	for _, attr := range attrs {
+		span.Attributes[attr.Key] = attr.Value
+	}
+	t.spans = append(t.spans, span)
+
+	return context.WithValue(ctx, recordingSpanKey{}, span), span
+}
+
+// SetAttributes adds or replaces attributes on the span
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, attr := range attrs {
+		s.Attributes[attr.Key] = attr.Value
+	}
+}
+
+// End finishes the span
+func (s *RecordedSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	if !s.Ended {
+		s.Ended = true
+		s.EndTime = time.Now()
+	}
+}
+
+// Spans returns copies of the recorded spans in start order
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(t.spans))
+	for i, span := range t.spans {
+		spans[i] = *span
+		spans[i].Attributes = make(map[string]interface{}, len(span.Attributes))
+		for k, v := range span.Attributes {
+			spans[i].Attributes[k] = v
+		}
+	}
+	return spans
+}
+
+// Find returns the recorded spans with the given name
+func (t *RecordingTracer) Find(name string) []RecordedSpan {
+	var found []RecordedSpan
+	for _, span := range t.Spans() {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+// runAttributes describes the options of a run
+func runAttributes(opts *RunOptions) []Attribute {
+	attrs := []Attribute{Attr("claude.format", string(opts.Format))}
+	if model := opts.ModelAlias; model != "" {
+		attrs = append(attrs, Attr("claude.model", model))
+	} else if opts.Model != "" {
+		attrs = append(attrs, Attr("claude.model", opts.Model))
+	}
+	if opts.ResumeID != "" {
+		attrs = append(attrs, Attr("claude.resume_id", opts.ResumeID))
+	}
+	return attrs
+}
+
+// endRunSpan records the outcome of a run on its span and ends it
+func endRunSpan(span Span, result *ClaudeResult, err error) {
+	if result != nil {
+		span.SetAttributes(
+			Attr("claude.session_id", result.SessionID),
+			Attr("claude.cost_usd", result.CostUSD),
+			Attr("claude.num_turns", result.NumTurns),
+			Attr("claude.duration_ms", result.DurationMS),
+		)
+	}
+	if err != nil {
+		span.SetAttributes(Attr("claude.error_type", errorTypeOf(err)), Attr("claude.error", err.Error()))
+	}
+	span.End()
+}
+
+// streamTracer turns streamed messages into turn and tool spans under a run span
+// Turns start with each new assistant message and end when the next one arrives or the stream ends;
+// tool spans run from a tool_use block to its matching tool_result
+type streamTracer struct {
+	tracer   Tracer
+	ctx      context.Context
+	turnCtx  context.Context
+	turn     Span
+	turnID   string
+	turns    int
+	tools    map[string]*toolSpan
+	toolUses int
+	// toolNames counts tool uses by tool name
+	toolNames map[string]int
+}
+
+// toolSpan is an open span for a tool use waiting for its result
+type toolSpan struct {
+	span  Span
+	start time.Time
+}
+
+// newStreamTracer creates a stream tracer for the run span in ctx
+func newStreamTracer(ctx context.Context, tracer Tracer) *streamTracer {
+	return &streamTracer{tracer: tracer, ctx: ctx, tools: make(map[string]*toolSpan), toolNames: make(map[string]int)}
+}
+
+// observe updates spans for a streamed message
+func (st *streamTracer) observe(msg Message) {
+	if msg.Type != "assistant" && msg.Type != "user" {
+		return
+	}
+
+	// The body was decoded with the stream line
+	inner := msg.Body
+	if inner == nil {
+		inner = &MessageBody{}
+	}
+
+	if msg.Type == "assistant" {
+		// The CLI may split one API message into several stream messages sharing its ID
+		if st.turn == nil || inner.ID == "" || inner.ID != st.turnID {
+			st.endTurn()
+			st.turns++
+			st.turnID = inner.ID
+			st.turnCtx, st.turn = st.tracer.Start(st.ctx, SpanTurn,
+				Attr("claude.turn", st.turns),
+				Attr("claude.message_id", inner.ID),
+			)
+		}
+		for _, block := range inner.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			st.toolUses++
+			st.toolNames[block.Name]++
+			_, span := st.tracer.Start(st.turnCtx, SpanTool,
+				Attr("claude.tool.name", block.Name),
+				Attr("claude.tool.id", block.ID),
+			)
+			st.tools[block.ID] = &toolSpan{span: span, start: time.Now()}
+		}
+		return
+	}
+
+	for _, block := range inner.Content {
+		if block.Type != "tool_result" {
+			continue
+		}
+		tool, ok := st.tools[block.ToolUseID]
+		if !ok {
+			continue
+		}
+		delete(st.tools, block.ToolUseID)
+		tool.span.SetAttributes(Attr("claude.tool.duration_ms", time.Since(tool.start).Milliseconds()))
+		if block.IsError {
+			tool.span.SetAttributes(Attr("claude.error_type", "tool_error"))
+		}
+		tool.span.End()
+	}
+}
+
+// endTurn ends the current turn span
+func (st *streamTracer) endTurn() {
+	if st.turn != nil {
+		st.turn.End()
+		st.turn = nil
+	}
+}
+
+// finish ends any open spans and returns the number of turns and tool uses seen
+func (st *streamTracer) finish() (turns, toolUses int) {
+	for id, tool := range st.tools {
+		tool.span.SetAttributes(
+			Attr("claude.tool.duration_ms", time.Since(tool.start).Milliseconds()),
+			Attr("claude.tool.incomplete", true),
+		)
+		tool.span.End()
+		delete(st.tools, id)
+	}
+	st.endTurn()
+	return st.turns, st.toolUses
+}
@@ -0,0 +1,139 @@
+package claude
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordingTracer(t *testing.T) {
+	tracer := NewRecordingTracer()
+
+	ctx, parent := tracer.Start(context.Background(), "parent", Attr("a", 1))
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(Attr("b", "two"))
+	child.End()
+	child.End()
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[1].ParentID != spans[0].ID || spans[0].ParentID != 0 {
+		t.Errorf("Expected child of parent, got %+v", spans)
+	}
+	if spans[0].Ended || !spans[1].Ended || spans[1].Attributes["b"] != "two" || spans[0].Attributes["a"] != 1 {
+		t.Errorf("Unexpected span state: %+v", spans)
+	}
+
+	parent.End()
+	if !tracer.Find("parent")[0].Ended {
+		t.Error("Expected parent to be ended")
+	}
+
+	// The no-op tracer leaves the context untouched
+	noopCtx, span := NoopTracer{}.Start(ctx, "ignored")
+	span.SetAttributes(Attr("x", 1))
+	span.End()
+	if noopCtx != ctx {
+		t.Error("Expected NoopTracer to return ctx unchanged")
+	}
+}
+
+func TestStreamPrompt_Tracing(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	output := strings.Join([]string{
+		`{"type":"system","subtype":"init","session_id":"abc"}`,
+		`{"type":"assistant","session_id":"abc","message":{"id":"m1","content":[{"type":"tool_use","id":"t1","name":"Bash"},{"type":"tool_use","id":"t2","name":"Read"}]}}`,
+		`{"type":"user","session_id":"abc","message":{"content":[{"type":"tool_result","tool_use_id":"t1"},{"type":"tool_result","tool_use_id":"t2","is_error":true}]}}`,
+		`{"type":"assistant","session_id":"abc","message":{"id":"m2","content":[{"type":"text","text":"done"}]}}`,
+		`{"type":"result","subtype":"success","result":"done","session_id":"abc","cost_usd":0.25,"num_turns":2}`,
+	}, "\n") + "\n"
+	execCommand = mockExecCommandStderr(output, "", 0)
+
+	tracer := NewRecordingTracer()
+	client := NewClient("claude", WithTracer(tracer))
+	if _, err := collectStream(client.StreamPrompt(context.Background(), "test", &RunOptions{Model: "sonnet"})); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := tracer.Find(SpanRun)
+	if len(runs) != 1 {
+		t.Fatalf("Expected 1 run span, got %d", len(runs))
+	}
+	run := runs[0]
+	if !run.Ended || run.Attributes["claude.cost_usd"] != 0.25 || run.Attributes["claude.model"] != "sonnet" ||
+		run.Attributes["claude.turns"] != 2 || run.Attributes["claude.tool_uses"] != 2 {
+		t.Errorf("Unexpected run span: %+v", run)
+	}
+
+	turns := tracer.Find(SpanTurn)
+	if len(turns) != 2 || turns[0].ParentID != run.ID || turns[1].Attributes["claude.message_id"] != "m2" {
+		t.Fatalf("Expected 2 turn spans under the run, got %+v", turns)
+	}
+
+	tools := tracer.Find(SpanTool)
+	if len(tools) != 2 {
+		t.Fatalf("Expected 2 tool spans, got %d", len(tools))
+	}
+	for _, tool := range tools {
+		if tool.ParentID != turns[0].ID || !tool.Ended {
+			t.Errorf("Expected ended tool span under the first turn, got %+v", tool)
+		}
+		if _, ok := tool.Attributes["claude.tool.duration_ms"]; !ok {
+			t.Errorf("Expected tool duration, got %+v", tool.Attributes)
+		}
+	}
+	if tools[0].Attributes["claude.tool.name"] != "Bash" || tools[0].Attributes["claude.error_type"] != nil {
+		t.Errorf("Unexpected Bash span: %+v", tools[0].Attributes)
+	}
+	if tools[1].Attributes["claude.error_type"] != "tool_error" {
+		t.Errorf("Expected failed tool result to set error type, got %+v", tools[1].Attributes)
+	}
+}
+
+func TestRunPromptWithRetry_Tracing(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	calls := 0
+	execCommand = func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		calls++
+		if calls == 1 {
+			return mockExecCommandStderr("", "network error: connection reset", 1)(ctx, name, arg...)
+		}
+		return mockExecCommandStderr(`{"type":"result","result":"ok","session_id":"abc"}`, "", 0)(ctx, name, arg...)
+	}
+
+	tracer := NewRecordingTracer()
+	client := NewClient("claude", WithTracer(tracer))
+	policy := &RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffFactor: 1}
+	if _, err := client.RunPromptWithRetryCtx(context.Background(), "test", &RunOptions{Format: JSONOutput}, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	retries := tracer.Find(SpanRetry)
+	if len(retries) != 1 || retries[0].Attributes["claude.retry.attempts"] != 2 {
+		t.Fatalf("Expected one retry span with 2 attempts, got %+v", retries)
+	}
+	runs := tracer.Find(SpanRun)
+	if len(runs) != 2 {
+		t.Fatalf("Expected a run span per attempt, got %d", len(runs))
+	}
+	for _, run := range runs {
+		if run.ParentID != retries[0].ID {
+			t.Errorf("Expected run span under the retry span, got %+v", run)
+		}
+	}
+	if runs[0].Attributes["claude.error_type"] != "network" || runs[1].Attributes["claude.session_id"] != "abc" {
+		t.Errorf("Unexpected run attributes: %+v, %+v", runs[0].Attributes, runs[1].Attributes)
+	}
+}
@@ -0,0 +1,162 @@
+package claude
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version of the Claude Code CLI
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// versionPattern finds the first "major.minor[.patch]" in a string such as "1.0.33 (Claude Code)"
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion extracts a version from CLI output or a version string
+func ParseVersion(s string) (Version, error) {
+	matches := versionPattern.FindStringSubmatch(s)
+	if matches == nil {
+		return Version{}, fmt.Errorf("no version found in %q", strings.TrimSpace(s))
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(matches[1])
+	v.Minor, _ = strconv.Atoi(matches[2])
+	if matches[3] != "" {
+		v.Patch, _ = strconv.Atoi(matches[3])
+	}
+	return v, nil
+}
+
+// String returns the version in "major.minor.patch" form
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than other
+func (v Version) Compare(other Version) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// VersionConstraint is a set of comparisons that a version must all satisfy
+//
+// Supported syntax (comparisons separated by spaces or commas):
+//   - Comparisons: ">=1.0.0", ">1.0", "<=2.0.0", "<2", "=1.0.33", "1.0.33"
+//   - Tilde ranges: "~1.0.30" (>=1.0.30 <1.1.0)
+//   - Caret ranges: "^1.0.30" (>=1.0.30 <2.0.0)
+type VersionConstraint struct {
+	comparisons []versionComparison
+	original    string
+}
+
+type versionComparison struct {
+	op      string
+	version Version
+}
+
+// ParseVersionConstraint parses a version constraint string
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	fields := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+
+	vc := &VersionConstraint{original: constraint}
+	for _, field := range fields {
+		op := strings.TrimRight(field, "0123456789.")
+		if op == field {
+			return nil, fmt.Errorf("invalid version constraint %q: missing version in %q", constraint, field)
+		}
+		raw := strings.TrimPrefix(field, op)
+		if !versionPattern.MatchString(raw) && !isNumber(raw) {
+			return nil, fmt.Errorf("invalid version constraint %q: bad version %q", constraint, raw)
+		}
+
+		version, partCount := parseConstraintVersion(raw)
+		switch op {
+		case ">=", ">", "<=", "<":
+			vc.comparisons = append(vc.comparisons, versionComparison{op, version})
+		case "", "=", "==":
+			vc.comparisons = append(vc.comparisons, versionComparison{"=", version})
+		case "~":
+			upper := Version{Major: version.Major, Minor: version.Minor + 1}
+			if partCount == 1 {
+				upper = Version{Major: version.Major + 1}
+			}
+			vc.comparisons = append(vc.comparisons, versionComparison{">=", version}, versionComparison{"<", upper})
+		case "^":
+			upper := Version{Major: version.Major + 1}
+			if version.Major == 0 {
+				upper = Version{Minor: version.Minor + 1}
+			}
+			vc.comparisons = append(vc.comparisons, versionComparison{">=", version}, versionComparison{"<", upper})
+		default:
+			return nil, fmt.Errorf("invalid version constraint %q: unknown operator %q", constraint, op)
+		}
+	}
+
+	return vc, nil
+}
+
+// parseConstraintVersion parses "1", "1.2" or "1.2.3" and reports how many parts were given
+func parseConstraintVersion(raw string) (Version, int) {
+	parts := strings.Split(raw, ".")
+	var nums [3]int
+	for i := 0; i < len(parts) && i < 3; i++ {
+		nums[i], _ = strconv.Atoi(parts[i])
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, len(parts)
+}
+
+// isNumber returns true if s is a non-empty run of digits
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// Allows returns true if v satisfies every comparison of the constraint
+func (vc *VersionConstraint) Allows(v Version) bool {
+	for _, c := range vc.comparisons {
+		cmp := v.Compare(c.version)
+		var ok bool
+		switch c.op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=":
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the original constraint string
+func (vc *VersionConstraint) String() string {
+	return vc.original
+}
@@ -0,0 +1,72 @@
+package claude
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Version
+		wantErr  bool
+	}{
+		{"1.0.33 (Claude Code)", Version{1, 0, 33}, false},
+		{"claude 2.1", Version{2, 1, 0}, false},
+		{"v0.2.9\n", Version{0, 2, 9}, false},
+		{"no version here", Version{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVersion(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseVersion(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVersionConstraint_Allows(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		allowed    bool
+	}{
+		{">=1.0.0 <2.0.0", "1.5.3", true},
+		{">=1.0.0 <2.0.0", "2.0.0", false},
+		{">=1.0.0, <2.0.0", "0.9.9", false},
+		{">1.0", "1.0.1", true},
+		{"<=1.0.33", "1.0.33", true},
+		{"1.0.33", "1.0.33", true},
+		{"=1.0.33", "1.0.34", false},
+		{"~1.0.30", "1.0.99", true},
+		{"~1.0.30", "1.1.0", false},
+		{"~1", "1.9.0", true},
+		{"^1.0.30", "1.9.0", true},
+		{"^1.0.30", "2.0.0", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+"/"+tt.version, func(t *testing.T) {
+			vc, err := ParseVersionConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseVersionConstraint(%q) failed: %v", tt.constraint, err)
+			}
+			v, _ := ParseVersion(tt.version)
+			if got := vc.Allows(v); got != tt.allowed {
+				t.Errorf("%q.Allows(%s) = %v, want %v", tt.constraint, tt.version, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestParseVersionConstraint_Invalid(t *testing.T) {
+	for _, constraint := range []string{"", ">=", "!1.0.0", ">=1..2", "latest"} {
+		if _, err := ParseVersionConstraint(constraint); err == nil {
+			t.Errorf("Expected error for constraint %q", constraint)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// TimeoutKind identifies which timeout stopped a Claude process
+type TimeoutKind string
+
+const (
+	// TimeoutStartup means the process wrote nothing to stdout within RunOptions.StartupTimeout
+	TimeoutStartup TimeoutKind = "startup"
+	// TimeoutIdle means the process wrote no output for RunOptions.IdleTimeout
+	TimeoutIdle TimeoutKind = "idle"
+	// TimeoutTotal means the run exceeded RunOptions.Timeout
+	TimeoutTotal TimeoutKind = "total"
+)
+
+// WatchdogWaitDelay bounds how long a killed process may keep its output pipes open,
+// e.g. through child processes that inherited them
+const WatchdogWaitDelay = 5 * time.Second
+
+// TimeoutError is the context cause when a Watchdog stops a process
+// It unwraps to context.DeadlineExceeded
+type TimeoutError struct {
+	Kind  TimeoutKind
+	Limit time.Duration
+}
+
+// Error implements the error interface
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %v exceeded", e.Kind, e.Limit)
+}
+
+// Unwrap returns context.DeadlineExceeded
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// TimeoutKindOf returns the kind of timeout that caused err, or "" if err is not a watchdog timeout
+func TimeoutKindOf(err error) TimeoutKind {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr.Kind
+	}
+	return ""
+}
+
+// Watchdog enforces the startup, idle and total timeouts of RunOptions on a Claude process
+// It cancels the context returned by StartWatchdog with a *TimeoutError, which kills the process
+// This is exported for use by the dangerous package
+type Watchdog struct {
+	startup time.Duration
+	idle    time.Duration
+	cancel  context.CancelCauseFunc
+	release context.CancelFunc
+
+	mu      sync.Mutex
+	start   time.Time
+	last    time.Time
+	started bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartWatchdog derives a context for running a Claude process under the timeouts in opts
+// The process must be created with the returned context; Stop must be called when the run ends
+func StartWatchdog(ctx context.Context, opts *RunOptions) (context.Context, *Watchdog) {
+	w := &Watchdog{release: func() {}, stop: make(chan struct{})}
+	var total time.Duration
+	if opts != nil {
+		w.startup, w.idle, total = opts.StartupTimeout, opts.IdleTimeout, opts.Timeout
+	}
+
+	if total > 0 {
+		ctx, w.release = context.WithTimeoutCause(ctx, total, &TimeoutError{Kind: TimeoutTotal, Limit: total})
+	}
+	ctx, w.cancel = context.WithCancelCause(ctx)
+
+	w.start = time.Now()
+	w.last = w.start
+	if w.active() {
+		go w.run(ctx)
+	}
+	return ctx, w
+}
+
+// active reports whether the watchdog watches output
+func (w *Watchdog) active() bool {
+	return w.startup > 0 || w.idle > 0
+}
+
+// run fires the first timeout that expires until the run ends
+func (w *Watchdog) run(ctx context.Context) {
+	_, wait := w.expired(time.Now())
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.stop:
+			return
+		case now := <-timer.C:
+			timeoutErr, wait := w.expired(now)
+			if timeoutErr != nil {
+				w.cancel(timeoutErr)
+				return
+			}
+			timer.Reset(wait)
+		}
+	}
+}
+
+// expired returns the timeout that has passed, if any, and otherwise the time until the next check
+// The idle timeout applies once stdout has started, or from the beginning without a startup timeout
+func (w *Watchdog) expired(now time.Time) (*TimeoutError, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wait := time.Duration(math.MaxInt64)
+	if !w.started && w.startup > 0 {
+		left := w.startup - now.Sub(w.start)
+		if left <= 0 {
+			return &TimeoutError{Kind: TimeoutStartup, Limit: w.startup}, 0
+		}
+		wait = left
+	}
+	if w.idle > 0 && (w.started || w.startup == 0) {
+		left := w.idle - now.Sub(w.last)
+		if left <= 0 {
+			return &TimeoutError{Kind: TimeoutIdle, Limit: w.idle}, 0
+		}
+		wait = min(wait, left)
+	}
+	return nil, wait
+}
+
+// touch records output; only stdout ends the startup phase
+func (w *Watchdog) touch(stdout bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+	if stdout {
+		w.started = true
+	}
+}
+
+// Watch wraps the command's Stdout and Stderr writers so their output resets the timeouts
+// When startup or idle timeouts are set it also bounds how long Wait waits for pipes after a kill
+// Call it before StdoutPipe or StderrPipe and wrap the pipes with StdoutReader and Stderr instead
+func (w *Watchdog) Watch(cmd *exec.Cmd) {
+	if cmd.Stdout != nil {
+		cmd.Stdout = w.Stdout(cmd.Stdout)
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr = w.Stderr(cmd.Stderr)
+	}
+	if w.active() && cmd.WaitDelay == 0 {
+		cmd.WaitDelay = WatchdogWaitDelay
+	}
+}
+
+// Stdout wraps a writer receiving the process's stdout
+func (w *Watchdog) Stdout(dst io.Writer) io.Writer {
+	return &activityWriter{w: dst, touch: func() { w.touch(true) }}
+}
+
+// Stderr wraps a writer receiving the process's stderr
+func (w *Watchdog) Stderr(dst io.Writer) io.Writer {
+	return &activityWriter{w: dst, touch: func() { w.touch(false) }}
+}
+
+// StdoutReader wraps a reader over the process's stdout pipe
+func (w *Watchdog) StdoutReader(src io.Reader) io.Reader {
+	return &activityReader{r: src, touch: func() { w.touch(true) }}
+}
+
+// Stop ends the watchdog and releases its context
+func (w *Watchdog) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.cancel(nil)
+		w.release()
+	})
+}
+
+// activityWriter calls touch for every non-empty write
+type activityWriter struct {
+	w     io.Writer
+	touch func()
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		a.touch()
+	}
+	return a.w.Write(p)
+}
+
+// activityReader calls touch for every non-empty read
+type activityReader struct {
+	r     io.Reader
+	touch func()
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.touch()
+	}
+	return n, err
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// mockExecScript returns a mock command running script with sh, ignoring the CLI arguments
+func mockExecScript(script string) func(context.Context, string, ...string) *exec.Cmd {
+	return func(ctx context.Context, name string, arg ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+}
+
+func TestWatchdog_Expired(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		startup  time.Duration
+		idle     time.Duration
+		started  bool
+		last     time.Duration // since start
+		at       time.Duration // since start
+		wantKind TimeoutKind
+		wantWait time.Duration
+	}{
+		{"Startup pending", time.Second, 0, false, 0, 400 * time.Millisecond, "", 600 * time.Millisecond},
+		{"Startup expired", time.Second, 0, false, 0, time.Second, TimeoutStartup, 0},
+		{"Idle waits for startup", time.Second, 100 * time.Millisecond, false, 0, 500 * time.Millisecond, "", 500 * time.Millisecond},
+		{"Idle after startup", time.Second, 100 * time.Millisecond, true, 400 * time.Millisecond, 550 * time.Millisecond, TimeoutIdle, 0},
+		{"Idle without startup", 0, 100 * time.Millisecond, false, 0, 150 * time.Millisecond, TimeoutIdle, 0},
+		{"Output resets idle", 0, 100 * time.Millisecond, true, 80 * time.Millisecond, 150 * time.Millisecond, "", 30 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watchdog{startup: tt.startup, idle: tt.idle, start: start, last: start.Add(tt.last), started: tt.started}
+			timeoutErr, wait := w.expired(start.Add(tt.at))
+			var kind TimeoutKind
+			if timeoutErr != nil {
+				kind = timeoutErr.Kind
+			}
+			if kind != tt.wantKind {
+				t.Errorf("expired() = %v, want kind %q", timeoutErr, tt.wantKind)
+			}
+			if timeoutErr == nil && wait != tt.wantWait {
+				t.Errorf("expired() wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRunPromptCtx_WatchdogTimeouts(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+	client := &ClaudeClient{BinPath: "claude"}
+
+	tests := []struct {
+		name     string
+		script   string
+		opts     RunOptions
+		wantKind TimeoutKind
+	}{
+		{"Startup", "exec sleep 5", RunOptions{StartupTimeout: 100 * time.Millisecond}, TimeoutStartup},
+		{"Idle", "echo started; exec sleep 5", RunOptions{IdleTimeout: 200 * time.Millisecond}, TimeoutIdle},
+		{"Total", "while true; do echo tick; sleep 0.02; done", RunOptions{IdleTimeout: time.Second, Timeout: 200 * time.Millisecond}, TimeoutTotal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execCommand = mockExecScript(tt.script)
+			start := time.Now()
+			_, err := client.RunPromptCtx(context.Background(), "test", &tt.opts)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Expected the process to be killed promptly, took %v", elapsed)
+			}
+
+			var claudeErr *ClaudeError
+			if !errors.As(err, &claudeErr) || claudeErr.Type != ErrorTimeout {
+				t.Fatalf("Expected timeout error, got %v", err)
+			}
+			if TimeoutKindOf(err) != tt.wantKind || claudeErr.Details["timeout_kind"] != string(tt.wantKind) {
+				t.Errorf("Expected %s timeout, got %v (details %v)", tt.wantKind, err, claudeErr.Details)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected errors.Is(%v, context.DeadlineExceeded)", err)
+			}
+		})
+	}
+
+	// Steady output keeps an idle timeout from firing
+	execCommand = mockExecScript("for i in 1 2 3 4 5; do echo line; sleep 0.05; done")
+	result, err := client.RunPromptCtx(context.Background(), "test", &RunOptions{StartupTimeout: time.Second, IdleTimeout: 300 * time.Millisecond})
+	if err != nil || result.Result != "line\nline\nline\nline\nline\n" {
+		t.Errorf("Expected run to complete, got %v, %v", result, err)
+	}
+}
+
+func TestStreamPrompt_IdleTimeout(t *testing.T) {
+	originalExecCommand := execCommand
+	defer func() {
+		execCommand = originalExecCommand
+	}()
+
+	execCommand = mockExecScript(`echo '{"type":"system","subtype":"init","session_id":"s1"}'; exec sleep 5`)
+	client := &ClaudeClient{BinPath: "claude"}
+
+	start := time.Now()
+	msgCh, errCh := client.StreamPrompt(context.Background(), "test", &RunOptions{StartupTimeout: time.Second, IdleTimeout: 200 * time.Millisecond})
+	messages, err := collectStream(msgCh, errCh)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected the stream to end promptly, took %v", elapsed)
+	}
+
+	if len(messages) != 1 || messages[0].Type != "system" {
+		t.Errorf("Expected the init message before the timeout, got %+v", messages)
+	}
+	if !errors.Is(err, ErrTimeout) || TimeoutKindOf(err) != TimeoutIdle {
+		t.Errorf("Expected idle timeout, got %v", err)
+	}
+}